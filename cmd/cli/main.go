@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/urfave/cli/v3"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/sequix/whypending/pkg/constant"
 	"github.com/sequix/whypending/pkg/ctrlc"
 	"github.com/sequix/whypending/pkg/k8s"
+	"github.com/sequix/whypending/pkg/ypd"
 )
 
 func main() {
@@ -22,11 +24,33 @@ func main() {
 				Name:  constant.FlagKubeConfig,
 				Usage: "Path to kubeconfig. Use ~/.kube/config or InClusterConfig by default",
 			},
+			&cli.StringFlag{
+				Name:  constant.FlagFrom,
+				Usage: "Read objects from a yaml/json file or a directory of them (e.g. kubectl get -o yaml dumps) instead of a cluster",
+			},
 			&cli.BoolFlag{
 				Name:    constant.FlagJson,
 				Aliases: []string{"j"},
 				Usage:   "Show json",
 			},
+			&cli.StringSliceFlag{
+				Name:  constant.FlagEnableCheckers,
+				Usage: "Only run these checkers, available: " + strings.Join(ypd.CheckerNames(), ",") + ". Only for engine " + constant.EngineYpd,
+			},
+			&cli.StringSliceFlag{
+				Name:  constant.FlagDisableCheckers,
+				Usage: "Do not run these checkers. Only for engine " + constant.EngineYpd,
+			},
+			&cli.StringFlag{
+				Name:  constant.FlagEngine,
+				Value: constant.EngineYpd,
+				Usage: fmt.Sprintf("One of %s, %s (upstream kube-scheduler filter plugins) or %s (show nodes where the two disagree)",
+					constant.EngineYpd, constant.EngineFramework, constant.EngineCompare),
+			},
+			&cli.StringFlag{
+				Name:  constant.FlagSchedulerConfig,
+				Usage: "Path to KubeSchedulerConfiguration. Plugins and plugin args of the profile matching the pod's schedulerName decide what to check",
+			},
 		},
 		UsageText: "[options] <namespace> <pod>",
 		Before:    Init,
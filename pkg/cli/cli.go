@@ -5,13 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config"
 
 	"github.com/sequix/whypending/pkg/constant"
+	"github.com/sequix/whypending/pkg/framework"
 	"github.com/sequix/whypending/pkg/k8s"
 	"github.com/sequix/whypending/pkg/ypd"
 )
@@ -35,11 +42,79 @@ func Action(ctx context.Context, argv *cli.Command) error {
 	if err != nil {
 		return fmt.Errorf("failed to list nodes: %w", err)
 	}
+	nsList, err := k8sClient.Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	// 以下对象只影响部分检查，没有 list 权限时视为空并给出 warning
+	var listWarnings []ypd.DetailWarning
+	leaseList, err := k8s.Client().CoordinationV1().Leases(v1.NamespaceNodeLease).List(ctx, metav1.ListOptions{})
+	if leaseList, err = optionalList(leaseList, err, "node leases", &listWarnings); err != nil {
+		return err
+	}
+	schedulerLeaseList, err := k8s.Client().CoordinationV1().Leases(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{})
+	if schedulerLeaseList, err = optionalList(schedulerLeaseList, err, "scheduler leases", &listWarnings); err != nil {
+		return err
+	}
+	pvcList, err := k8sClient.PersistentVolumeClaims(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pvcs: %w", err)
+	}
+	pvList, err := k8sClient.PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pvs: %w", err)
+	}
+	scList, err := k8s.Client().StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	csiNodeList, err := k8s.Client().StorageV1().CSINodes().List(ctx, metav1.ListOptions{})
+	if csiNodeList, err = optionalList(csiNodeList, err, "csi nodes", &listWarnings); err != nil {
+		return err
+	}
+	vaList, err := k8s.Client().StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if vaList, err = optionalList(vaList, err, "volume attachments", &listWarnings); err != nil {
+		return err
+	}
+	pcList, err := k8s.Client().SchedulingV1().PriorityClasses().List(ctx, metav1.ListOptions{})
+	if pcList, err = optionalList(pcList, err, "priority classes", &listWarnings); err != nil {
+		return err
+	}
+	rcList, err := k8s.Client().NodeV1().RuntimeClasses().List(ctx, metav1.ListOptions{})
+	if rcList, err = optionalList(rcList, err, "runtime classes", &listWarnings); err != nil {
+		return err
+	}
+	pdbList, err := k8s.Client().PolicyV1().PodDisruptionBudgets(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if pdbList, err = optionalList(pdbList, err, "pdbs", &listWarnings); err != nil {
+		return err
+	}
+	// 未启用 DRA 的集群没有 resource.k8s.io API，与没有权限一样视为没有相关对象
+	draClient := k8s.Client().ResourceV1beta1()
+	// 其他 namespace 的 claim 同样占用 device，需要列出所有 namespace 才能算出已分配的 device
+	claimList, err := draClient.ResourceClaims(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if claimList, err = optionalList(claimList, err, "resource claims", &listWarnings); err != nil {
+		return err
+	}
+	claimTemplateList, err := draClient.ResourceClaimTemplates(namespace).List(ctx, metav1.ListOptions{})
+	if claimTemplateList, err = optionalList(claimTemplateList, err, "resource claim templates", &listWarnings); err != nil {
+		return err
+	}
+	deviceClassList, err := draClient.DeviceClasses().List(ctx, metav1.ListOptions{})
+	if deviceClassList, err = optionalList(deviceClassList, err, "device classes", &listWarnings); err != nil {
+		return err
+	}
+	sliceList, err := draClient.ResourceSlices().List(ctx, metav1.ListOptions{})
+	if sliceList, err = optionalList(sliceList, err, "resource slices", &listWarnings); err != nil {
+		return err
+	}
+	eventList, err := k8sClient.Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
 	var (
 		pod   *v1.Pod
 		pods  = podList.Items
 		nodes = nodeList.Items
-		pvs   []v1.PersistentVolume
 	)
 	for i := range pods {
 		p := &pods[i]
@@ -51,70 +126,260 @@ func Action(ctx context.Context, argv *cli.Command) error {
 	if pod == nil {
 		return fmt.Errorf("not found pod %s/%s", namespace, podName)
 	}
-	for _, v := range pod.Spec.Volumes {
-		if v.PersistentVolumeClaim == nil {
-			continue
-		}
-		pvcName := v.PersistentVolumeClaim.ClaimName
-		pvc, err := k8sClient.PersistentVolumeClaims(pod.Namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	cluster := &ypd.Cluster{
+		Pods:                   pods,
+		Nodes:                  nodes,
+		PVCs:                   pvcList.Items,
+		PVs:                    pvList.Items,
+		Namespaces:             nsList.Items,
+		SchedulerLeases:        schedulerLeaseList.Items,
+		Leases:                 leaseList.Items,
+		StorageClasses:         scList.Items,
+		CSINodes:               csiNodeList.Items,
+		VolumeAttachments:      vaList.Items,
+		PriorityClasses:        pcList.Items,
+		PDBs:                   pdbList.Items,
+		RuntimeClasses:         rcList.Items,
+		ResourceClaims:         claimList.Items,
+		ResourceClaimTemplates: claimTemplateList.Items,
+		DeviceClasses:          deviceClassList.Items,
+		ResourceSlices:         sliceList.Items,
+		Events:                 eventList.Items,
+		Now:                    k8s.Now(),
+	}
+	podDetail := ypd.WhyPod(pod, cluster)
+	podDetail.Warnings = append(listWarnings, podDetail.Warnings...)
+	opts := ypd.Options{
+		Enabled:  argv.StringSlice(constant.FlagEnableCheckers),
+		Disabled: argv.StringSlice(constant.FlagDisableCheckers),
+	}
+	profile, err := schedulerProfile(argv.String(constant.FlagSchedulerConfig), pod)
+	if err != nil {
+		return err
+	}
+	if profile != nil {
+		profileOpts := framework.YpdOptions(profile)
+		profileOpts.Enabled = opts.Enabled
+		profileOpts.Disabled = append(profileOpts.Disabled, opts.Disabled...)
+		opts = profileOpts
+	}
+	engine := argv.String(constant.FlagEngine)
+	// 上游插件不受 checker 开关影响，比较结果会把被关闭的 checker 报成分歧，请使用 --scheduler-config 关闭插件
+	if engine != constant.EngineYpd && (argv.IsSet(constant.FlagEnableCheckers) || argv.IsSet(constant.FlagDisableCheckers)) {
+		return fmt.Errorf("--%s and --%s only apply to engine %s, use --%s to disable plugins for engine %s",
+			constant.FlagEnableCheckers, constant.FlagDisableCheckers, constant.EngineYpd, constant.FlagSchedulerConfig, engine)
+	}
+	if engine == constant.EngineFramework {
+		ans, err := whyPendingFramework(ctx, pod, cluster, profile)
 		if err != nil {
-			return fmt.Errorf("failed to get pvc %s/%s: %w", pod.Namespace, pvcName, err)
+			return err
 		}
-		pvName := pvc.Spec.VolumeName
-		if len(pvName) == 0 {
-			continue
+		schedEvent := ypd.WhySchedulingEvent(pod, cluster, ans)
+		if showJson {
+			preemption, err := ypd.WhyPreemptionWithOptions(pod, cluster, opts)
+			if err != nil {
+				return err
+			}
+			printJson(ans, podDetail, preemption, schedEvent)
+			return nil
 		}
-		pv, err := k8sClient.PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+		fmt.Println("Summary:")
+		printSummary(ans)
+		fmt.Println()
+		fmt.Println("Scheduler events:")
+		printSchedulingEvent(schedEvent)
+		fmt.Println()
+		fmt.Println("Findings:")
+		printFindings(ans)
+		return nil
+	}
+	ans, err := ypd.WhyPendingWithOptions(pod, cluster, opts)
+	if err != nil {
+		return err
+	}
+	schedEvent := ypd.WhySchedulingEvent(pod, cluster, ans)
+	switch engine {
+	case constant.EngineYpd:
+	case constant.EngineCompare:
+		fwAns, err := whyPendingFramework(ctx, pod, cluster, profile)
 		if err != nil {
-			return fmt.Errorf("failed to get pv %s: %w", pvName, err)
+			return err
 		}
-		pvs = append(pvs, *pv)
+		printDisagreements(framework.Compare(ans, fwAns), showJson)
+		return nil
+	default:
+		return fmt.Errorf("unknown engine %s", engine)
 	}
-	ans := ypd.WhyPending(pod, pods, nodes, pvs)
 
+	// 抢占模拟开销较大，只在需要输出时计算
+	preemption, err := ypd.WhyPreemptionWithOptions(pod, cluster, opts)
+	if err != nil {
+		return err
+	}
 	if showJson {
-		printJson(ans)
+		printJson(ans, podDetail, preemption, schedEvent)
 		return nil
 	}
-	printAll(ans)
+	printAll(ans, podDetail, preemption, schedEvent)
 	return nil
 }
 
-func printJson(ans []ypd.Detail) {
+// optionalList 在没有 list 权限或集群没有对应 API 时返回空列表并记录 warning，其他错误照常返回
+func optionalList[T any](list *T, err error, resource string, warnings *[]ypd.DetailWarning) (*T, error) {
+	switch {
+	case apierrors.IsForbidden(err):
+		*warnings = append(*warnings, ypd.DetailWarning{
+			Reason:  ypd.ReasonListForbidden,
+			Message: fmt.Sprintf("no permission to list %s, related checks treat them as empty: %v", resource, err),
+		})
+		return new(T), nil
+	case apierrors.IsNotFound(err):
+		*warnings = append(*warnings, ypd.DetailWarning{
+			Reason:  ypd.ReasonListNotFound,
+			Message: fmt.Sprintf("cluster does not serve %s, related checks treat them as empty", resource),
+		})
+		return new(T), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", resource, err)
+	}
+	return list, nil
+}
+
+// schedulerProfile 从 path 读取调度器配置，返回 pod 的 schedulerName 对应的 profile，path 为空时返回 nil
+func schedulerProfile(path string, pod *v1.Pod) (*config.KubeSchedulerProfile, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	cfg, err := framework.LoadSchedulerConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return framework.SchedulerProfile(cfg, pod.Spec.SchedulerName)
+}
+
+func whyPendingFramework(ctx context.Context, pod *v1.Pod, cluster *ypd.Cluster, profile *config.KubeSchedulerProfile) ([]ypd.Detail, error) {
+	if profile == nil {
+		return framework.WhyPending(ctx, pod, cluster)
+	}
+	return framework.WhyPendingWithProfile(ctx, pod, cluster, profile)
+}
+
+func printJson(ans []ypd.Detail, podDetail ypd.PodDetail, preemption *ypd.DetailPreemption, schedEvent *ypd.DetailSchedulingEvent) {
 	enc := json.NewEncoder(os.Stdout)
+	_ = enc.Encode(podDetail)
 	for _, a := range ans {
 		_ = enc.Encode(a)
 	}
+	_ = enc.Encode(preemption)
+	if schedEvent != nil {
+		_ = enc.Encode(schedEvent)
+	}
 }
 
-func printAll(ans []ypd.Detail) {
+func printAll(ans []ypd.Detail, podDetail ypd.PodDetail, preemption *ypd.DetailPreemption, schedEvent *ypd.DetailSchedulingEvent) {
+	if len(podDetail.Blockers) > 0 {
+		fmt.Println("Pod blockers:")
+		for _, b := range podDetail.Blockers {
+			fmt.Printf("%s: %s\n", b.Reason, b.Message)
+		}
+		fmt.Println()
+	}
+	if len(podDetail.Warnings) > 0 {
+		fmt.Println("Pod warnings:")
+		for _, w := range podDetail.Warnings {
+			fmt.Printf("%s: %s\n", w.Reason, w.Message)
+		}
+		fmt.Println()
+	}
+
 	fmt.Println("Summary:")
 	printSummary(ans)
 	fmt.Println()
 
+	fmt.Println("Scheduler events:")
+	printSchedulingEvent(schedEvent)
+	fmt.Println()
+
+	fmt.Println("Persistent volume claims:")
+	printClaims(podDetail.Claims)
+	fmt.Println()
+
+	fmt.Println("Node health:")
+	printNodeHealth(ans)
+	fmt.Println()
+
 	fmt.Println("Resources not enough:")
 	printResource(ans)
 	fmt.Println()
 
+	fmt.Println("Resources will free soon:")
+	printWillFreeSoon(ans)
+	fmt.Println()
+
 	fmt.Println("Node affinity mismatches:")
 	printNodeAffinity(ans)
 	fmt.Println()
 
 	fmt.Println("Taints not tolerated:")
-	printTaint(ans)
+	printTaint(ans, func(a *ypd.Detail) []ypd.DetailTaintNotTolerated { return a.NodeTaintNotTolerated })
+	fmt.Println()
+
+	fmt.Println("PreferNoSchedule taints not tolerated (non-blocking):")
+	printTaint(ans, func(a *ypd.Detail) []ypd.DetailTaintNotTolerated { return a.SoftTaintNotTolerated })
 	fmt.Println()
 
 	fmt.Println("Pod anti-affinity mismatches:")
 	printPodAntiAffinity(ans)
 	fmt.Println()
 
+	fmt.Println("Existing pods' anti-affinity:")
+	printExistingPodAntiAffinity(ans)
+	fmt.Println()
+
 	fmt.Println("Pod affinity mismatches:")
 	printPodAffinity(ans)
 	fmt.Println()
 
+	fmt.Println("Topology spread mismatches:")
+	printTopologySpread(ans)
+	fmt.Println()
+
+	fmt.Println("Host port conflicts:")
+	printHostPort(ans)
+	fmt.Println()
+
+	fmt.Println("Volume limits exceeded:")
+	printVolumeLimit(ans)
+	fmt.Println()
+
+	fmt.Println("Volume binding mismatches:")
+	printVolumeBinding(ans)
+	fmt.Println()
+
+	fmt.Println("Volume conflicts:")
+	printVolumeConflict(ans)
+	fmt.Println()
+
+	fmt.Println("Resource claims not satisfied:")
+	printResourceClaim(ans)
+	fmt.Println()
+
 	fmt.Println("Pv affinity mismatches:")
 	printPvAffinity(ans)
 	fmt.Println()
+
+	fmt.Println("Preemption:")
+	printPreemption(preemption)
+	fmt.Println()
+
+	fmt.Println("Other findings:")
+	printOtherFindings(ans)
+	fmt.Println()
+
+	fmt.Println("Warnings:")
+	printWarnings(ans)
+	fmt.Println()
 }
 
 func printSummary(ans []ypd.Detail) {
@@ -123,13 +388,29 @@ func printSummary(ans []ypd.Detail) {
 	}
 }
 
+func printNodeHealth(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, h := range a.NodeHealth {
+			f := fmt.Sprintf("%s %s", a.NodeName, h.Type)
+			if !h.LastTransitionTime.IsZero() {
+				f += " since " + h.LastTransitionTime.Format(time.RFC3339)
+			}
+			f += ": " + h.Message
+			if !h.Blocking {
+				f += " (non-blocking)"
+			}
+			fmt.Println(f)
+		}
+	}
+}
+
 func printResource(ans []ypd.Detail) {
 	var fields []string
 	for _, a := range ans {
 		fields = fields[:0]
 		fields = append(fields, a.NodeName)
 		for _, r := range a.ResourceNotEnough {
-			f := fmt.Sprintf("%s(%s<%s)", r.ResourceName, r.Left.String(), r.Required.String())
+			f := fmt.Sprintf("%s(%s<%s%s)", r.ResourceName, r.Left.String(), r.Required.String(), requestParts(&r))
 			fields = append(fields, f)
 		}
 		if len(fields) > 1 {
@@ -138,31 +419,119 @@ func printResource(ans []ypd.Detail) {
 	}
 }
 
-func printNodeAffinity(ans []ypd.Detail) {
+func printWillFreeSoon(ans []ypd.Detail) {
 	var fields []string
 	for _, a := range ans {
 		fields = fields[:0]
 		fields = append(fields, a.NodeName)
+		for _, r := range a.WillFreeSoon {
+			var res []string
+			for name, qty := range r.Resources {
+				res = append(res, fmt.Sprintf("%s=%s", name, qty.String()))
+			}
+			sort.Strings(res)
+			f := fmt.Sprintf("%s/%s(%s)", r.Namespace, r.PodName, strings.Join(res, ","))
+			fields = append(fields, f)
+		}
+		if a.ResourceEnoughAfterTermination {
+			fields = append(fields, "=> resources enough after termination")
+		}
+		if len(fields) > 1 {
+			fmt.Println(strings.Join(fields, " "))
+		}
+	}
+}
+
+// requestParts 列出 pod 有效资源请求的组成，导致资源不足的部分以 * 标记
+func requestParts(r *ypd.DetailResourceNotEnough) string {
+	var parts []string
+	add := func(part ypd.RequestPart, label string, q resource.Quantity) {
+		f := label + "=" + q.String()
+		if r.Dominant == part {
+			f = "*" + f
+		}
+		parts = append(parts, f)
+	}
+	running := r.Containers.DeepCopy()
+	running.Add(r.Sidecars)
+	switch {
+	case r.Dominant == ypd.RequestPartPodLevel || !r.PodLevel.IsZero():
+		add(ypd.RequestPartPodLevel, "pod", r.PodLevel)
+	case r.InitContainers.Cmp(running) > 0:
+		add(ypd.RequestPartInitContainers, "init", r.InitContainers)
+	case !r.Sidecars.IsZero():
+		add(ypd.RequestPartContainers, "containers", r.Containers)
+		add(ypd.RequestPartSidecars, "sidecars", r.Sidecars)
+	}
+	if !r.Overhead.IsZero() {
+		add(ypd.RequestPartOverhead, "overhead", r.Overhead)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, ",")
+}
+
+func printNodeAffinity(ans []ypd.Detail) {
+	var fields, terms, addedTerms []string
+	for _, a := range ans {
+		fields = fields[:0]
+		fields = append(fields, a.NodeName)
+		terms = terms[:0]
+		addedTerms = addedTerms[:0]
 		for _, r := range a.NodeAffinityMismatch {
-			for _, t := range r.Term.MatchExpressions {
-				vs := strings.Join(t.Values, ",")
-				f := fmt.Sprintf("%s:%s:%s", t.Key, t.Operator, vs)
-				fields = append(fields, f)
+			if r.AddedAffinity {
+				addedTerms = append(addedTerms, formatUnmatched(r.Unmatched))
+			} else if len(r.RuntimeClass) > 0 {
+				fields = append(fields, fmt.Sprintf("runtimeClass(%s)%s", r.RuntimeClass, formatUnmatched(r.Unmatched)))
+			} else if r.NodeSelector {
+				fields = append(fields, "nodeSelector"+formatUnmatched(r.Unmatched))
+			} else {
+				terms = append(terms, formatUnmatched(r.Unmatched))
 			}
 		}
+		if len(terms) > 0 {
+			fields = append(fields, "nodeAffinity"+strings.Join(terms, " or "))
+		}
+		if len(addedTerms) > 0 {
+			fields = append(fields, "addedAffinity"+strings.Join(addedTerms, " or "))
+		}
 		if len(fields) > 1 {
 			fmt.Println(strings.Join(fields, " "))
 		}
 	}
 }
 
-func printTaint(ans []ypd.Detail) {
+// formatUnmatched 输出形如 "wanted zone In [a,b], node has zone=c"
+func formatUnmatched(unmatched []ypd.DetailUnmatchedRequirement) string {
+	if len(unmatched) == 0 {
+		return "(invalid or empty term)"
+	}
 	var fields []string
-	for _, a := range ans {
+	for _, u := range unmatched {
+		r := u.Requirement
+		f := fmt.Sprintf("wanted %s %s", r.Key, r.Operator)
+		if len(r.Values) > 0 {
+			f += fmt.Sprintf(" [%s]", strings.Join(r.Values, ","))
+		}
+		if u.NodeHasKey {
+			f += fmt.Sprintf(", node has %s=%s", r.Key, u.NodeValue)
+		} else {
+			f += fmt.Sprintf(", node has no %s", r.Key)
+		}
+		fields = append(fields, f)
+	}
+	return "(" + strings.Join(fields, "; ") + ")"
+}
+
+func printTaint(ans []ypd.Detail, taints func(*ypd.Detail) []ypd.DetailTaintNotTolerated) {
+	var fields []string
+	for i := range ans {
+		a := &ans[i]
 		fields = fields[:0]
 		fields = append(fields, a.NodeName)
-		for _, r := range a.NodeTaintNotTolerated {
-			f := fmt.Sprintf("%s=%s", r.Taint.Key, r.Taint.Value)
+		for _, r := range taints(a) {
+			f := fmt.Sprintf("%s=%s:%s", r.Taint.Key, r.Taint.Value, r.Taint.Effect)
 			fields = append(fields, f)
 		}
 		if len(fields) > 1 {
@@ -177,8 +546,12 @@ func printPodAffinity(ans []ypd.Detail) {
 		fields = fields[:0]
 		fields = append(fields, a.NodeName)
 		for _, r := range a.PodAffinityMismatch {
-			sel, _ := metav1.LabelSelectorAsSelector(r.Term.LabelSelector)
-			fields = append(fields, sel.String())
+			ns := strings.Join(r.Namespaces, ",")
+			if r.MissingTopologyKey {
+				fields = append(fields, fmt.Sprintf("%s(node has no %s)", r.Selector, r.Term.TopologyKey))
+			} else {
+				fields = append(fields, fmt.Sprintf("%s(no pod of namespaces [%s] in %s=%s)", r.Selector, ns, r.Term.TopologyKey, r.TopologyValue))
+			}
 		}
 		if len(fields) > 1 {
 			fmt.Println(strings.Join(fields, " "))
@@ -192,7 +565,22 @@ func printPodAntiAffinity(ans []ypd.Detail) {
 		fields = fields[:0]
 		fields = append(fields, a.NodeName)
 		for _, r := range a.PodAntiAffinityMismatch {
-			f := fmt.Sprintf("%s/%s", r.Namespace, r.PodName)
+			f := fmt.Sprintf("%s/%s(on %s in %s=%s)", r.Namespace, r.PodName, r.PodNodeName, r.Term.TopologyKey, r.TopologyValue)
+			fields = append(fields, f)
+		}
+		if len(fields) > 1 {
+			fmt.Println(strings.Join(fields, " "))
+		}
+	}
+}
+
+func printExistingPodAntiAffinity(ans []ypd.Detail) {
+	var fields []string
+	for _, a := range ans {
+		fields = fields[:0]
+		fields = append(fields, a.NodeName)
+		for _, r := range a.ExistingPodAntiAffinity {
+			f := fmt.Sprintf("%s/%s(on %s excludes %s in %s=%s)", r.Namespace, r.PodName, r.PodNodeName, r.Selector, r.Term.TopologyKey, r.TopologyValue)
 			fields = append(fields, f)
 		}
 		if len(fields) > 1 {
@@ -201,20 +589,250 @@ func printPodAntiAffinity(ans []ypd.Detail) {
 	}
 }
 
+func printTopologySpread(ans []ypd.Detail) {
+	var fields []string
+	for _, a := range ans {
+		fields = fields[:0]
+		fields = append(fields, a.NodeName)
+		for _, r := range a.TopologySpreadMismatch {
+			c := r.Constraint
+			if r.MissingTopologyKey {
+				fields = append(fields, fmt.Sprintf("%s(node has no %s)", c.TopologyKey, c.TopologyKey))
+				continue
+			}
+			var counts []string
+			for domain, n := range r.DomainCounts {
+				counts = append(counts, fmt.Sprintf("%s=%d", domain, n))
+			}
+			sort.Strings(counts)
+			f := fmt.Sprintf("%s=%s(skew %d>maxSkew %d, counts %s)", c.TopologyKey, r.TopologyValue, r.Skew, c.MaxSkew, strings.Join(counts, ","))
+			fields = append(fields, f)
+		}
+		if len(fields) > 1 {
+			fmt.Println(strings.Join(fields, " "))
+		}
+	}
+}
+
+func printHostPort(ans []ypd.Detail) {
+	var fields []string
+	for _, a := range ans {
+		fields = fields[:0]
+		fields = append(fields, a.NodeName)
+		for _, r := range a.HostPortConflict {
+			f := fmt.Sprintf("%s/%s:%d(used by %s/%s on %s)", r.Protocol, r.HostIP, r.HostPort, r.Namespace, r.PodName, r.PodHostIP)
+			fields = append(fields, f)
+		}
+		if len(fields) > 1 {
+			fmt.Println(strings.Join(fields, " "))
+		}
+	}
+}
+
+func printVolumeLimit(ans []ypd.Detail) {
+	var fields []string
+	for _, a := range ans {
+		fields = fields[:0]
+		fields = append(fields, a.NodeName)
+		for _, r := range a.VolumeLimitExceeded {
+			f := fmt.Sprintf("%s(%d+%d>%d)", r.Driver, r.Attached, r.Required, r.Limit)
+			fields = append(fields, f)
+		}
+		if len(fields) > 1 {
+			fmt.Println(strings.Join(fields, " "))
+		}
+	}
+}
+
+func printClaims(claims []ypd.DetailPvc) {
+	for _, c := range claims {
+		f := fmt.Sprintf("%s %s", c.ClaimName, c.Status)
+		if len(c.StorageClassName) > 0 {
+			f += " storageclass=" + c.StorageClassName
+		}
+		f += ": " + c.Message
+		if len(c.AvailablePVs) > 0 {
+			f += fmt.Sprintf(", available pvs [%s]", strings.Join(c.AvailablePVs, ","))
+		}
+		fmt.Println(f)
+		for _, e := range c.Events {
+			fmt.Printf("  %s %s %s(x%d): %s\n", e.LastTimestamp.Format(time.RFC3339), e.Type, e.Reason, e.Count, e.Message)
+		}
+	}
+}
+
+func printVolumeBinding(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, r := range a.VolumeBindingMismatch {
+			f := fmt.Sprintf("%s %s: %s", a.NodeName, r.ClaimName, r.Message)
+			if len(r.CandidatePVs) > 0 {
+				f += fmt.Sprintf(" [%s]", strings.Join(r.CandidatePVs, ","))
+			}
+			fmt.Println(f)
+		}
+	}
+}
+
+func printVolumeConflict(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, r := range a.VolumeConflict {
+			holder := r.NodeName
+			if len(r.PodName) > 0 {
+				holder = fmt.Sprintf("%s/%s on %s", r.Namespace, r.PodName, r.NodeName)
+			} else if len(r.AttachmentName) > 0 {
+				holder = fmt.Sprintf("%s via %s", r.NodeName, r.AttachmentName)
+			}
+			// 只有 RWOP 冲突阻止调度，RWO 冲突只会让 pod 等待 volume 卸载
+			level := "warning"
+			if r.AccessMode == v1.ReadWriteOncePod {
+				level = "blocking"
+			}
+			fmt.Printf("%s %s(%s) held by %s (%s): %s\n", a.NodeName, r.ClaimName, r.AccessMode, holder, level, r.Message)
+		}
+	}
+}
+
+func printResourceClaim(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, r := range a.ResourceClaimNotSatisfied {
+			name := r.Claim
+			if len(r.Request) > 0 {
+				name += "/" + r.Request
+			}
+			if len(r.DeviceClass) > 0 {
+				name += fmt.Sprintf("(%s)", r.DeviceClass)
+			}
+			fmt.Printf("%s %s: %s\n", a.NodeName, name, r.Message)
+		}
+	}
+}
+
 func printPvAffinity(ans []ypd.Detail) {
 	var fields []string
 	for _, a := range ans {
 		fields = fields[:0]
 		fields = append(fields, a.NodeName)
-		pvNames := map[string]struct{}{}
+		pv2terms := map[string][]string{}
+		var pvNames []string
 		for _, r := range a.PvAffinityMismatch {
-			pvNames[r.PvName] = struct{}{}
+			if _, ok := pv2terms[r.PvName]; !ok {
+				pvNames = append(pvNames, r.PvName)
+			}
+			pv2terms[r.PvName] = append(pv2terms[r.PvName], formatUnmatched(r.Unmatched))
 		}
-		for pv := range pvNames {
-			fields = append(fields, pv)
+		for _, pv := range pvNames {
+			fields = append(fields, fmt.Sprintf("%s%s", pv, strings.Join(pv2terms[pv], " or ")))
 		}
 		if len(fields) > 1 {
 			fmt.Println(strings.Join(fields, " "))
 		}
 	}
 }
+
+// printSchedulingEvent 并列调度器 event 与 ypd 的各原因 node 数，不一致的行以 ! 开头
+func printSchedulingEvent(e *ypd.DetailSchedulingEvent) {
+	if e == nil {
+		fmt.Println("no FailedScheduling event")
+		return
+	}
+	fmt.Printf("%s %s\n", e.Event.LastTimestamp.Format(time.RFC3339), e.Event.Message)
+	fmt.Printf("  %-9s %-9s %s\n", "SCHEDULER", "YPD", "REASON")
+	fmt.Printf("  %-9d %-9d %s\n", e.Nodes, e.YpdNodes, "nodes in total")
+	for _, r := range e.Reasons {
+		prefix := " "
+		if r.Disagree {
+			prefix = "!"
+		}
+		event, ypdNodes, msg := strconv.Itoa(r.EventNodes), strconv.Itoa(r.YpdNodes), r.Message
+		if len(r.Message) == 0 {
+			event, msg = "-", string(r.Reason)
+		} else if len(r.Reason) > 0 {
+			msg += fmt.Sprintf(" (%s)", r.Reason)
+		} else {
+			ypdNodes = "-"
+		}
+		fmt.Printf("%s %-9s %-9s %s\n", prefix, event, ypdNodes, msg)
+	}
+	for _, d := range e.Disagreements {
+		fmt.Println("! " + d)
+	}
+}
+
+func printPreemption(p *ypd.DetailPreemption) {
+	fmt.Printf("priority=%d preemptionPolicy=%s\n", p.Priority, p.PreemptionPolicy)
+	if len(p.Message) > 0 {
+		fmt.Println(p.Message)
+	}
+	for _, c := range p.Candidates {
+		var victims []string
+		for _, v := range c.Victims {
+			f := fmt.Sprintf("%s/%s(priority=%d)", v.Namespace, v.PodName, v.Priority)
+			if len(v.ViolatesPDB) > 0 {
+				f += fmt.Sprintf("[violates pdb %s]", strings.Join(v.ViolatesPDB, ","))
+			}
+			victims = append(victims, f)
+		}
+		prefix := " "
+		if c.NodeName == p.NominatedNodeName {
+			prefix = "*"
+		}
+		fmt.Printf("%s %s evicts %s\n", prefix, c.NodeName, strings.Join(victims, " "))
+	}
+}
+
+func printFindings(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, f := range a.Findings {
+			fmt.Printf("%s %s %s(%s): %s\n", a.NodeName, f.Checker, f.Reason, f.Severity, f.Message)
+		}
+	}
+}
+
+func printDisagreements(ds []framework.Disagreement, showJson bool) {
+	if showJson {
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range ds {
+			_ = enc.Encode(d)
+		}
+		return
+	}
+	if len(ds) == 0 {
+		fmt.Println("ypd and framework engines agree on every node")
+		return
+	}
+	fmt.Println("Engine disagreements:")
+	format := func(schedulable bool, reasons []ypd.Reason) string {
+		if schedulable {
+			return string(ypd.ReasonSchedulable)
+		}
+		var s []string
+		for _, r := range reasons {
+			s = append(s, string(r))
+		}
+		return strings.Join(s, ",")
+	}
+	for _, d := range ds {
+		fmt.Printf("%s ypd=%s framework=%s\n", d.NodeName,
+			format(d.YpdSchedulable, d.YpdReasons), format(d.FrameworkSchedulable, d.FrameworkReasons))
+	}
+}
+
+// printOtherFindings 输出第三方 Checker 的结果，内置 Checker 的结果已在上面分类输出
+func printOtherFindings(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, f := range a.Findings {
+			if ypd.IsBuiltinChecker(f.Checker) || f.Severity == ypd.SeverityWarning {
+				continue
+			}
+			fmt.Printf("%s %s %s(%s): %s\n", a.NodeName, f.Checker, f.Reason, f.Severity, f.Message)
+		}
+	}
+}
+
+func printWarnings(ans []ypd.Detail) {
+	for _, a := range ans {
+		for _, w := range a.Warnings {
+			fmt.Printf("%s %s: %s\n", a.NodeName, w.Reason, w.Message)
+		}
+	}
+}
@@ -5,4 +5,16 @@ const (
 	FlagNamespace  = "namespace"
 	FlagPodName    = "pod"
 	FlagJson       = "json"
+	FlagFrom       = "from"
+
+	FlagEnableCheckers  = "enable-checkers"
+	FlagDisableCheckers = "disable-checkers"
+	FlagEngine          = "engine"
+	FlagSchedulerConfig = "scheduler-config"
+
+	// EngineYpd 使用 ypd 自身的检查，EngineFramework 使用上游 kube-scheduler 的 filter 插件，
+	// EngineCompare 同时运行两者并列出结论不同的 node
+	EngineYpd       = "ypd"
+	EngineFramework = "framework"
+	EngineCompare   = "compare"
 )
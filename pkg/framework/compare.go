@@ -0,0 +1,53 @@
+package framework
+
+import (
+	"slices"
+
+	"github.com/sequix/whypending/pkg/ypd"
+)
+
+// Disagreement 表示 ypd 与 framework 两个引擎对某个 node 能否调度的结论不同
+type Disagreement struct {
+	NodeName             string       `json:"nodeName"`
+	YpdSchedulable       bool         `json:"ypdSchedulable"`
+	FrameworkSchedulable bool         `json:"frameworkSchedulable"`
+	YpdReasons           []ypd.Reason `json:"ypdReasons,omitempty"`
+	FrameworkReasons     []ypd.Reason `json:"frameworkReasons,omitempty"`
+}
+
+// Compare 按 node 名对比两个引擎的结果，返回结论不同的 node
+func Compare(ours, theirs []ypd.Detail) []Disagreement {
+	name2theirs := map[string]*ypd.Detail{}
+	for i := range theirs {
+		name2theirs[theirs[i].NodeName] = &theirs[i]
+	}
+	var ans []Disagreement
+	for i := range ours {
+		o := &ours[i]
+		t, ok := name2theirs[o.NodeName]
+		if !ok {
+			continue
+		}
+		if o.Schedulable == t.Schedulable {
+			continue
+		}
+		ans = append(ans, Disagreement{
+			NodeName:             o.NodeName,
+			YpdSchedulable:       o.Schedulable,
+			FrameworkSchedulable: t.Schedulable,
+			YpdReasons:           blockingReasons(o),
+			FrameworkReasons:     blockingReasons(t),
+		})
+	}
+	return ans
+}
+
+func blockingReasons(d *ypd.Detail) []ypd.Reason {
+	var ans []ypd.Reason
+	for _, f := range d.Findings {
+		if f.Severity == ypd.SeverityBlocking && !slices.Contains(ans, f.Reason) {
+			ans = append(ans, f.Reason)
+		}
+	}
+	return ans
+}
@@ -0,0 +1,78 @@
+package framework
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config/scheme"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/names"
+
+	"github.com/sequix/whypending/pkg/ypd"
+)
+
+// LoadSchedulerConfig 读取 KubeSchedulerConfiguration 文件并填充默认值，与 kube-scheduler --config 一致
+func LoadSchedulerConfig(path string) (*config.KubeSchedulerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scheduler config %s: %w", path, err)
+	}
+	obj, gvk, err := scheme.Codecs.UniversalDecoder().Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode scheduler config %s: %w", path, err)
+	}
+	cfg, ok := obj.(*config.KubeSchedulerConfiguration)
+	if !ok {
+		return nil, fmt.Errorf("scheduler config %s is %v, not KubeSchedulerConfiguration", path, gvk)
+	}
+	return cfg, nil
+}
+
+// SchedulerProfile 返回 schedulerName 对应的 profile，schedulerName 为空时使用 default-scheduler
+func SchedulerProfile(cfg *config.KubeSchedulerConfiguration, schedulerName string) (*config.KubeSchedulerProfile, error) {
+	if len(schedulerName) == 0 {
+		schedulerName = v1.DefaultSchedulerName
+	}
+	for i := range cfg.Profiles {
+		if cfg.Profiles[i].SchedulerName == schedulerName {
+			return &cfg.Profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no profile for scheduler %s in scheduler config", schedulerName)
+}
+
+// checkerPlugins 将内置 Checker 对应到实现相同检查的上游插件，未列出的 Checker 与插件同名
+var checkerPlugins = map[string]string{
+	ypd.CheckerNodeHealth: names.NodeUnschedulable,
+}
+
+// YpdOptions 将 profile 转换为 ypd 的 Options：profile 未启用对应 filter 插件的内置 Checker 被禁用，
+// 插件参数转换为 Checker 的配置。非内置的 Checker 不受 profile 影响
+func YpdOptions(profile *config.KubeSchedulerProfile) ypd.Options {
+	var (
+		opts    ypd.Options
+		enabled = filterPluginNames(profile)
+	)
+	for _, name := range ypd.CheckerNames() {
+		if !ypd.IsBuiltinChecker(name) {
+			continue
+		}
+		plugin, ok := checkerPlugins[name]
+		if !ok {
+			plugin = name
+		}
+		if !slices.Contains(enabled, plugin) {
+			opts.Disabled = append(opts.Disabled, name)
+		}
+	}
+	if args, ok := pluginArgs(profile, names.NodeResourcesFit).(*config.NodeResourcesFitArgs); ok {
+		opts.IgnoredResources = args.IgnoredResources
+		opts.IgnoredResourceGroups = args.IgnoredResourceGroups
+	}
+	if args, ok := pluginArgs(profile, names.NodeAffinity).(*config.NodeAffinityArgs); ok {
+		opts.AddedAffinity = args.AddedAffinity
+	}
+	return opts
+}
@@ -0,0 +1,268 @@
+// Package framework 使用上游 kube-scheduler 的 filter 插件分析 pod，用于校验 ypd 自身的实现
+package framework
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config/latest"
+	"k8s.io/kubernetes/pkg/scheduler/backend/cache"
+	schedframework "k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/interpodaffinity"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/names"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/volumebinding"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/metrics"
+
+	"github.com/sequix/whypending/pkg/ypd"
+)
+
+var registerMetrics sync.Once
+
+// WhyPending 使用默认 profile 中的 filter 插件分析 pod 能否调度到每个 node
+func WhyPending(ctx context.Context, pod *v1.Pod, cluster *ypd.Cluster) ([]ypd.Detail, error) {
+	cfg, err := latest.Default()
+	if err != nil {
+		return nil, fmt.Errorf("failed to default scheduler configuration: %w", err)
+	}
+	return WhyPendingWithProfile(ctx, pod, cluster, &cfg.Profiles[0])
+}
+
+// WhyPendingWithProfile 使用 profile 中启用的 filter 插件及其参数分析 pod
+func WhyPendingWithProfile(ctx context.Context, pod *v1.Pod, cluster *ypd.Cluster, profile *config.KubeSchedulerProfile) ([]ypd.Detail, error) {
+	if pod == nil || cluster == nil || len(cluster.Nodes) == 0 {
+		return nil, nil
+	}
+	// 插件会上报 metrics，未注册时 metrics 对象为空
+	registerMetrics.Do(metrics.Register)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client := fake.NewClientset(clusterObjects(cluster)...)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	snapshot := cache.NewSnapshot(nodePods(pod, cluster), nodes(cluster))
+	registry := plugins.NewInTreeRegistry()
+	fwk, err := frameworkruntime.NewFramework(ctx, registry, profile,
+		frameworkruntime.WithClientSet(client),
+		frameworkruntime.WithInformerFactory(factory),
+		frameworkruntime.WithSnapshotSharedLister(snapshot),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduler framework: %w", err)
+	}
+	// framework 在遇到第一个失败的插件时即停止，为了得到每个插件的结果，单独创建并运行每个 filter 插件
+	filters, err := filterPlugins(ctx, registry, profile, fwk)
+	if err != nil {
+		return nil, err
+	}
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	nodeInfos, err := snapshot.NodeInfos().List()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		state    = schedframework.NewCycleState()
+		findings = make([][]ypd.Finding, len(nodeInfos))
+	)
+	for _, pl := range filters {
+		var result *schedframework.PreFilterResult
+		if pre, ok := pl.(schedframework.PreFilterPlugin); ok {
+			var status *schedframework.Status
+			result, status = pre.PreFilter(ctx, state, pod)
+			if status.IsSkip() {
+				continue
+			}
+			// PreFilter 失败时 pod 在所有 node 上都无法调度
+			if !status.IsSuccess() {
+				f := toFinding(pl.Name(), status)
+				for i := range nodeInfos {
+					findings[i] = append(findings[i], f)
+				}
+				continue
+			}
+		}
+		for i, nodeInfo := range nodeInfos {
+			if !result.AllNodes() && !result.NodeNames.Has(nodeInfo.Node().Name) {
+				findings[i] = append(findings[i], toFinding(pl.Name(), schedframework.NewStatus(
+					schedframework.UnschedulableAndUnresolvable, "node(s) didn't satisfy plugin "+pl.Name())))
+				continue
+			}
+			if status := pl.(schedframework.FilterPlugin).Filter(ctx, state, pod, nodeInfo); !status.IsSuccess() {
+				findings[i] = append(findings[i], toFinding(pl.Name(), status))
+			}
+		}
+	}
+
+	ans := make([]ypd.Detail, 0, len(nodeInfos))
+	for i, nodeInfo := range nodeInfos {
+		ans = append(ans, ypd.NewDetail(nodeInfo.Node().Name, findings[i]))
+	}
+	// 与 ypd 引擎的输出保持相同的 node 顺序
+	order := map[string]int{}
+	for i := range cluster.Nodes {
+		order[cluster.Nodes[i].Name] = i
+	}
+	slices.SortFunc(ans, func(a, b ypd.Detail) int { return order[a.NodeName] - order[b.NodeName] })
+	return ans, nil
+}
+
+// filterPlugins 按 profile 中的顺序创建所有启用的 filter 插件
+func filterPlugins(ctx context.Context, registry frameworkruntime.Registry, profile *config.KubeSchedulerProfile, fwk schedframework.Handle) ([]schedframework.Plugin, error) {
+	var ans []schedframework.Plugin
+	for _, name := range filterPluginNames(profile) {
+		factory, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("plugin %s not found in the in-tree registry", name)
+		}
+		pl, err := factory(ctx, pluginArgs(profile, name), fwk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create plugin %s: %w", name, err)
+		}
+		if _, ok := pl.(schedframework.FilterPlugin); ok {
+			ans = append(ans, pl)
+		}
+	}
+	return ans, nil
+}
+
+// filterPluginNames 返回 profile 在 filter 扩展点可能启用的插件，其中可能有未实现 Filter 的插件
+func filterPluginNames(profile *config.KubeSchedulerProfile) []string {
+	var names []string
+	// 默认配置已将 multiPoint.disabled 合并进 multiPoint.enabled，这里只需处理 filter 扩展点自身的配置
+	if p := profile.Plugins; p != nil {
+		for _, e := range p.MultiPoint.Enabled {
+			if !slices.ContainsFunc(p.Filter.Disabled, func(d config.Plugin) bool { return d.Name == e.Name || d.Name == "*" }) {
+				names = append(names, e.Name)
+			}
+		}
+		for _, e := range p.Filter.Enabled {
+			if !slices.Contains(names, e.Name) {
+				names = append(names, e.Name)
+			}
+		}
+	}
+	return names
+}
+
+// pluginArgs 返回 profile 中插件 name 的参数，未配置时为 nil
+func pluginArgs(profile *config.KubeSchedulerProfile, name string) runtime.Object {
+	var args runtime.Object
+	for _, c := range profile.PluginConfig {
+		if c.Name == name {
+			args = c.Args
+		}
+	}
+	return args
+}
+
+// pluginReasons 将上游插件对应到 ypd 的 Reason
+var pluginReasons = map[string]ypd.Reason{
+	names.NodeResourcesFit:   ypd.ReasonResourceNotEnough,
+	names.NodeName:           ypd.ReasonNodeAffinityMismatch,
+	names.NodeAffinity:       ypd.ReasonNodeAffinityMismatch,
+	names.TaintToleration:    ypd.ReasonNodeTaintNotTolerated,
+	names.NodeUnschedulable:  ypd.ReasonNodeUnhealthy,
+	names.NodePorts:          ypd.ReasonHostPortConflict,
+	names.InterPodAffinity:   ypd.ReasonPodAffinityMismatch,
+	names.PodTopologySpread:  ypd.ReasonTopologySpreadMismatch,
+	names.VolumeBinding:      ypd.ReasonVolumeBindingMismatch,
+	names.VolumeZone:         ypd.ReasonPvAffinityMismatch,
+	names.VolumeRestrictions: ypd.ReasonVolumeConflict,
+	names.NodeVolumeLimits:   ypd.ReasonVolumeLimitExceeded,
+	names.DynamicResources:   ypd.ReasonResourceClaimNotSatisfied,
+}
+
+func toFinding(plugin string, status *schedframework.Status) ypd.Finding {
+	reason, ok := pluginReasons[plugin]
+	if !ok {
+		reason = ypd.Reason(plugin)
+	}
+	reasons := status.Reasons()
+	switch {
+	case slices.Contains(reasons, interpodaffinity.ErrReasonAntiAffinityRulesNotMatch):
+		reason = ypd.ReasonPodAntiAffinityMismatch
+	case slices.Contains(reasons, interpodaffinity.ErrReasonExistingAntiAffinityRulesNotMatch):
+		reason = ypd.ReasonExistingPodAntiAffinity
+	case slices.Contains(reasons, string(volumebinding.ErrReasonNodeConflict)):
+		reason = ypd.ReasonPvAffinityMismatch
+	}
+	severity := ypd.SeverityBlocking
+	if status.Code() == schedframework.Error {
+		severity = ypd.SeverityWarning
+	}
+	return ypd.Finding{
+		Checker:  plugin,
+		Reason:   reason,
+		Severity: severity,
+		Message:  strings.Join(reasons, ", "),
+		Data:     status.Code().String(),
+	}
+}
+
+// clusterObjects 返回插件通过 informer 读取的对象，pod 和 node 由 snapshot 提供
+func clusterObjects(cluster *ypd.Cluster) []runtime.Object {
+	var ans []runtime.Object
+	for i := range cluster.Namespaces {
+		ans = append(ans, &cluster.Namespaces[i])
+	}
+	for i := range cluster.PVCs {
+		ans = append(ans, &cluster.PVCs[i])
+	}
+	for i := range cluster.PVs {
+		ans = append(ans, &cluster.PVs[i])
+	}
+	for i := range cluster.StorageClasses {
+		ans = append(ans, &cluster.StorageClasses[i])
+	}
+	for i := range cluster.CSINodes {
+		ans = append(ans, &cluster.CSINodes[i])
+	}
+	for i := range cluster.VolumeAttachments {
+		ans = append(ans, &cluster.VolumeAttachments[i])
+	}
+	for i := range cluster.ResourceClaims {
+		ans = append(ans, &cluster.ResourceClaims[i])
+	}
+	for i := range cluster.DeviceClasses {
+		ans = append(ans, &cluster.DeviceClasses[i])
+	}
+	for i := range cluster.ResourceSlices {
+		ans = append(ans, &cluster.ResourceSlices[i])
+	}
+	return ans
+}
+
+// nodePods 返回已调度且未结束的 pod，不含待调度的 pod 自身
+func nodePods(pod *v1.Pod, cluster *ypd.Cluster) []*v1.Pod {
+	var ans []*v1.Pod
+	for i := range cluster.Pods {
+		p := &cluster.Pods[i]
+		if len(p.Spec.NodeName) == 0 || p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if p.Namespace == pod.Namespace && p.Name == pod.Name {
+			continue
+		}
+		ans = append(ans, p)
+	}
+	return ans
+}
+
+func nodes(cluster *ypd.Cluster) []*v1.Node {
+	ans := make([]*v1.Node, 0, len(cluster.Nodes))
+	for i := range cluster.Nodes {
+		ans = append(ans, &cluster.Nodes[i])
+	}
+	return ans
+}
@@ -0,0 +1,137 @@
+package framework
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/sequix/whypending/pkg/ypd"
+)
+
+func TestWhyPending(t *testing.T) {
+	newNode := func(name, cpu string) v1.Node {
+		n := v1.Node{}
+		n.Name = name
+		n.Status.Allocatable = v1.ResourceList{
+			v1.ResourceCPU:  resource.MustParse(cpu),
+			v1.ResourcePods: resource.MustParse("110"),
+		}
+		return n
+	}
+	tainted := newNode("tainted", "4")
+	tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	cluster := &ypd.Cluster{Nodes: []v1.Node{tainted, newNode("small", "500m"), newNode("fit", "4")}}
+
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{
+		Name:      "app",
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+	}}}}
+	pod.Namespace, pod.Name = "default", "pending"
+
+	theirs, err := WhyPending(context.Background(), pod, cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tainted NodeTaintNotTolerated", "small ResourceNotEnough", "fit Schedulable"}
+	for i, d := range theirs {
+		if got := d.String(); got != want[i] {
+			t.Fatalf("want %s, got %s", want[i], got)
+		}
+	}
+	if ds := Compare(ypd.WhyPending(pod, cluster), theirs); len(ds) != 0 {
+		t.Fatalf("want engines agree, got %+v", ds)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	blocked := ypd.NewDetail("n1", []ypd.Finding{{Reason: ypd.ReasonHostPortConflict, Severity: ypd.SeverityBlocking}})
+	ds := Compare([]ypd.Detail{blocked, ypd.NewDetail("n2", nil)}, []ypd.Detail{ypd.NewDetail("n1", nil), ypd.NewDetail("n2", nil)})
+	if len(ds) != 1 || ds[0].NodeName != "n1" || ds[0].YpdSchedulable || !ds[0].FrameworkSchedulable {
+		t.Fatalf("want n1 disagreement, got %+v", ds)
+	}
+}
+
+func TestSchedulerProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`apiVersion: kubescheduler.config.k8s.io/v1
+kind: KubeSchedulerConfiguration
+profiles:
+- schedulerName: default-scheduler
+- schedulerName: gpu-scheduler
+  plugins:
+    filter:
+      disabled:
+      - name: TaintToleration
+  pluginConfig:
+  - name: NodeResourcesFit
+    args:
+      ignoredResourceGroups: ["example.com"]
+  - name: NodeAffinity
+    args:
+      addedAffinity:
+        requiredDuringSchedulingIgnoredDuringExecution:
+          nodeSelectorTerms:
+          - matchExpressions:
+            - {key: gpu, operator: Exists}
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadSchedulerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SchedulerProfile(cfg, "unknown"); err == nil {
+		t.Fatal("want error for unknown scheduler")
+	}
+	profile, err := SchedulerProfile(cfg, "gpu-scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := YpdOptions(profile)
+	// DynamicResources 依赖默认关闭的 feature gate，不在默认插件中
+	if !slices.Contains(opts.Disabled, ypd.CheckerTaintToleration) || slices.Contains(opts.Disabled, ypd.CheckerNodeResourcesFit) ||
+		!slices.Equal(opts.IgnoredResourceGroups, []string{"example.com"}) || opts.AddedAffinity == nil {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+
+	newNode := func(name string, labels map[string]string) v1.Node {
+		n := v1.Node{}
+		n.Name, n.Labels = name, labels
+		n.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+		n.Status.Allocatable = v1.ResourceList{
+			v1.ResourceCPU:  resource.MustParse("4"),
+			v1.ResourcePods: resource.MustParse("110"),
+		}
+		return n
+	}
+	cluster := &ypd.Cluster{Nodes: []v1.Node{newNode("cpu", nil), newNode("gpu", map[string]string{"gpu": "a100"})}}
+	pod := &v1.Pod{Spec: v1.PodSpec{SchedulerName: "gpu-scheduler", Containers: []v1.Container{{
+		Name:      "app",
+		Resources: v1.ResourceRequirements{Requests: v1.ResourceList{"example.com/foo": resource.MustParse("1")}},
+	}}}}
+	pod.Namespace, pod.Name = "default", "pending"
+
+	ours, err := ypd.WhyPendingWithOptions(pod, cluster, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := WhyPendingWithProfile(context.Background(), pod, cluster, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cpu NodeAffinityMismatch", "gpu Schedulable"}
+	for i := range want {
+		if got := ours[i].String(); got != want[i] {
+			t.Fatalf("ypd: want %s, got %s", want[i], got)
+		}
+	}
+	if ds := Compare(ours, theirs); len(ds) != 0 {
+		t.Fatalf("want engines agree, got %+v", ds)
+	}
+}
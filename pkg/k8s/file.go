@@ -0,0 +1,218 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// fileSource 从 kubectl get -o yaml/json 导出的文件读取对象，用于无法访问集群时离线分析
+type fileSource struct {
+	client *fake.Clientset
+	now    time.Time
+}
+
+// NewFileSource 读取 path 下的对象，path 可以是文件或目录，目录下递归读取 .yaml、.yml 和 .json 文件。
+// 文件可以包含多个 yaml 文档，以及 kind 为 List 或 XxxList 的列表；scheme 中没有的类型会被忽略，
+// 文件按路径顺序读取，同一对象出现多次时以最后一次为准
+func NewFileSource(path string) (Source, error) {
+	files, err := manifestFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		keys []string
+		objs = map[string]runtime.Object{}
+	)
+	for _, file := range files {
+		fileObjs, err := readManifest(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range fileObjs {
+			key, err := objectKey(obj)
+			if err != nil {
+				return nil, fmt.Errorf("invalid object in %s: %w", file, err)
+			}
+			if _, ok := objs[key]; !ok {
+				keys = append(keys, key)
+			}
+			objs[key] = obj
+		}
+	}
+
+	s := &fileSource{client: fake.NewClientset()}
+	for _, key := range keys {
+		obj := objs[key]
+		if err := s.client.Tracker().Add(obj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		if t := objectTime(obj); t.After(s.now) {
+			s.now = t
+		}
+	}
+	return s, nil
+}
+
+func (s *fileSource) Client() kubernetes.Interface {
+	return s.client
+}
+
+// Now 返回导出文件中最新的时间，近似导出的时间，避免导出后时间流逝导致 lease 被判断为过期
+func (s *fileSource) Now() time.Time {
+	return s.now
+}
+
+// manifestFiles 返回 path 本身，或目录 path 下所有 manifest 文件
+func manifestFiles(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".yaml", ".yml", ".json":
+			if !d.IsDir() {
+				files = append(files, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// readManifest 读取文件中的所有对象，展开其中的列表
+func readManifest(file string) ([]runtime.Object, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		ans    []runtime.Object
+		reader = yaml.NewYAMLReader(bufio.NewReader(f))
+	)
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		data, err := sigsyaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		// 只有注释的文档
+		if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+			continue
+		}
+		obj, err := runtime.Decode(unstructured.UnstructuredJSONScheme, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		var items []unstructured.Unstructured
+		switch o := obj.(type) {
+		case *unstructured.UnstructuredList:
+			items = o.Items
+		case *unstructured.Unstructured:
+			items = []unstructured.Unstructured{*o}
+		}
+		for i := range items {
+			typed, err := toTyped(&items[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert %s %s in %s: %w", items[i].GetKind(), items[i].GetName(), file, err)
+			}
+			if typed != nil {
+				ans = append(ans, typed)
+			}
+		}
+	}
+	return ans, nil
+}
+
+// toTyped 将对象转换为 client-go 中的类型，类型未注册时返回 nil
+func toTyped(u *unstructured.Unstructured) (runtime.Object, error) {
+	gvk := u.GroupVersionKind()
+	typed, err := scheme.Scheme.New(gvk)
+	if runtime.IsNotRegisteredError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed); err != nil {
+		return nil, err
+	}
+	typed.GetObjectKind().SetGroupVersionKind(gvk)
+	return typed, nil
+}
+
+func objectKey(obj runtime.Object) (string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	gk := obj.GetObjectKind().GroupVersionKind().GroupKind()
+	return gk.String() + "/" + m.GetNamespace() + "/" + m.GetName(), nil
+}
+
+// objectTime 返回对象上记录的最新时间
+func objectTime(obj runtime.Object) time.Time {
+	var ans time.Time
+	if m, err := meta.Accessor(obj); err == nil {
+		ans = m.GetCreationTimestamp().Time
+	}
+	latest := func(t time.Time) {
+		if t.After(ans) {
+			ans = t
+		}
+	}
+	switch o := obj.(type) {
+	case *coordinationv1.Lease:
+		if o.Spec.RenewTime != nil {
+			latest(o.Spec.RenewTime.Time)
+		}
+	case *v1.Event:
+		latest(o.LastTimestamp.Time)
+		latest(o.EventTime.Time)
+	case *v1.Node:
+		for _, c := range o.Status.Conditions {
+			latest(c.LastHeartbeatTime.Time)
+		}
+	}
+	return ans
+}
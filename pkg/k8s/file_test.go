@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"nodes.json": `{"apiVersion":"v1","kind":"List","items":[
+			{"apiVersion":"v1","kind":"Node","metadata":{"name":"n1"}},
+			{"apiVersion":"v1","kind":"Node","metadata":{"name":"n2"}}]}`,
+		"sub/pods.yaml": `apiVersion: v1
+kind: PodList
+items:
+- metadata: {name: p1, namespace: default}
+- metadata: {name: p2, namespace: kube-system}
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: ignored}
+---
+apiVersion: coordination.k8s.io/v1
+kind: Lease
+metadata: {name: n1, namespace: kube-node-lease}
+spec: {renewTime: "2026-01-01T00:00:00.000000Z"}
+`,
+		// 按路径顺序读取，重复的对象以后读到的为准
+		"sub/z-pod.yml": `{apiVersion: v1, kind: Pod, metadata: {name: p1, namespace: default, labels: {app: x}}}`,
+		"README.md":     "not a manifest",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewFileSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	nodes, err := s.Client().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil || len(nodes.Items) != 2 {
+		t.Fatalf("want 2 nodes, got %v %v", nodes, err)
+	}
+	pods, err := s.Client().CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+	if err != nil || len(pods.Items) != 1 || pods.Items[0].Labels["app"] != "x" {
+		t.Fatalf("want pod p1 from z-pod.yml, got %v %v", pods, err)
+	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); !s.Now().Equal(want) {
+		t.Fatalf("want now %v, got %v", want, s.Now())
+	}
+}
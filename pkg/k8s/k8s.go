@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	"k8s.io/client-go/kubernetes"
@@ -14,15 +15,44 @@ import (
 	"github.com/sequix/whypending/pkg/constant"
 )
 
-var (
-	k8sConfig *rest.Config
-	k8sClient kubernetes.Interface
-)
+// Source 是 ypd 读取集群对象的数据源
+type Source interface {
+	Client() kubernetes.Interface
+	// Now 返回数据源对应的时间，用于判断 lease 等是否过期，零值表示当前时间
+	Now() time.Time
+}
+
+var source Source
 
 func Init(ctx context.Context, argv *cli.Command) error {
+	var err error
+	if from := argv.String(constant.FlagFrom); len(from) > 0 {
+		source, err = NewFileSource(from)
+	} else {
+		source, err = NewAPIServerSource(argv.String(constant.FlagKubeConfig))
+	}
+	return err
+}
+
+func Client() kubernetes.Interface {
+	return source.Client()
+}
+
+func Now() time.Time {
+	return source.Now()
+}
+
+// apiServerSource 从 kube-apiserver 读取对象
+type apiServerSource struct {
+	client kubernetes.Interface
+}
+
+// NewAPIServerSource 使用 kubeconfig 连接集群，kubeconfig 为空时使用 ~/.kube/config 或 InClusterConfig
+func NewAPIServerSource(kubeconfig string) (Source, error) {
 	var (
-		err    error
-		config = argv.String(constant.FlagKubeConfig)
+		err       error
+		k8sConfig *rest.Config
+		config    = kubeconfig
 	)
 	if len(config) == 0 {
 		config = filepath.Join(os.Getenv("HOME"), ".kube", "config")
@@ -36,16 +66,20 @@ func Init(ctx context.Context, argv *cli.Command) error {
 		k8sConfig, err = clientcmd.BuildConfigFromFlags("", config)
 	}
 	if err != nil {
-		return fmt.Errorf("failed to init k8s config %s: %w", config, err)
+		return nil, fmt.Errorf("failed to init k8s config %s: %w", config, err)
 	}
 
-	k8sClient, err = kubernetes.NewForConfig(k8sConfig)
+	client, err := kubernetes.NewForConfig(k8sConfig)
 	if err != nil {
-		return fmt.Errorf("failed to init k8s client: %w", err)
+		return nil, fmt.Errorf("failed to init k8s client: %w", err)
 	}
-	return nil
+	return &apiServerSource{client: client}, nil
 }
 
-func Client() kubernetes.Interface {
-	return k8sClient
+func (s *apiServerSource) Client() kubernetes.Interface {
+	return s.client
+}
+
+func (s *apiServerSource) Now() time.Time {
+	return time.Time{}
 }
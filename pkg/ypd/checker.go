@@ -0,0 +1,179 @@
+package ypd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Severity 表示一条 Finding 对调度的影响
+type Severity string
+
+const (
+	// SeverityBlocking 表示 pod 不能调度到该 node
+	SeverityBlocking Severity = "Blocking"
+	// SeverityWarning 表示检查无法得出准确结论
+	SeverityWarning Severity = "Warning"
+	// SeverityInfo 只供参考，不影响调度
+	SeverityInfo Severity = "Info"
+)
+
+// Finding 是 Checker 在某个 node 上的一条检查结果
+type Finding struct {
+	Checker  string   `json:"checker"`
+	Reason   Reason   `json:"reason"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// 结构化的详细信息，内置 Checker 使用 Detail* 类型
+	Data any `json:"data,omitempty"`
+}
+
+func newFinding(reason Reason, severity Severity, data any, format string, args ...any) Finding {
+	return Finding{
+		Reason:   reason,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Data:     data,
+	}
+}
+
+// NewDetail 汇总一个 node 上的 Finding，用于其他引擎输出与 ypd 相同格式的结果
+func NewDetail(nodeName string, findings []Finding) Detail {
+	ans := Detail{NodeName: nodeName, Schedulable: true}
+	for _, f := range findings {
+		ans.addFinding(f)
+	}
+	return ans
+}
+
+// CheckInput 是 Checker 检查一个 node 所需的输入
+type CheckInput struct {
+	Pod  *v1.Pod
+	Node *v1.Node
+	// node 上的 pod，不含已结束的 pod 和待调度的 pod 自身；模拟抢占时为驱逐后剩余的 pod
+	NodePods []v1.Pod
+	Cluster  *Cluster
+
+	snap *snapshot
+}
+
+// Checker 检查 pod 能否调度到某个 node，第三方的 Checker 在 init 中调用 Register 注册
+type Checker interface {
+	// Name 是 Checker 的唯一名称，用于启用或禁用
+	Name() string
+	Check(in *CheckInput) []Finding
+}
+
+// CheckerFunc 将函数包装为 Checker
+func CheckerFunc(name string, check func(in *CheckInput) []Finding) Checker {
+	return &checkerFunc{name: name, check: check}
+}
+
+type checkerFunc struct {
+	name  string
+	check func(in *CheckInput) []Finding
+}
+
+func (c *checkerFunc) Name() string                   { return c.name }
+func (c *checkerFunc) Check(in *CheckInput) []Finding { return c.check(in) }
+
+var (
+	registryMu sync.RWMutex
+	// 按注册顺序排列
+	registry []Checker
+	builtins = map[string]bool{}
+)
+
+// Register 注册 Checker，名称为空或重复时 panic
+func Register(c Checker) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name := c.Name()
+	if len(name) == 0 {
+		panic("ypd: Register checker with empty name")
+	}
+	if slices.ContainsFunc(registry, func(r Checker) bool { return r.Name() == name }) {
+		panic("ypd: Register called twice for checker " + name)
+	}
+	registry = append(registry, c)
+}
+
+func registerBuiltin(name string, check func(in *CheckInput) []Finding) {
+	Register(CheckerFunc(name, check))
+	builtins[name] = true
+}
+
+// CheckerNames 按注册顺序返回所有 Checker 的名称
+func CheckerNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ans := make([]string, 0, len(registry))
+	for _, c := range registry {
+		ans = append(ans, c.Name())
+	}
+	return ans
+}
+
+// IsBuiltinChecker 判断 Checker 是否为 ypd 内置
+func IsBuiltinChecker(name string) bool {
+	return builtins[name]
+}
+
+// Options 选择 WhyPending 运行的 Checker，以及对应 kube-scheduler 插件参数的配置
+type Options struct {
+	// 非空时只运行这些 Checker
+	Enabled  []string
+	Disabled []string
+	// 对应 NodeResourcesFitArgs，NodeResourcesFit 不检查这些扩展资源，
+	// IgnoredResourceGroups 按资源名中 "/" 前的部分匹配
+	IgnoredResources      []string
+	IgnoredResourceGroups []string
+	// 对应 NodeAffinityArgs.addedAffinity，在 pod 自身的 node affinity 之外额外要求 node 满足
+	AddedAffinity *v1.NodeAffinity
+}
+
+// ignoresResource 与上游一致，只有扩展资源可以被忽略
+func (o *Options) ignoresResource(name v1.ResourceName) bool {
+	if !isExtendedResourceName(name) {
+		return false
+	}
+	if slices.Contains(o.IgnoredResources, string(name)) {
+		return true
+	}
+	group, _, _ := strings.Cut(string(name), "/")
+	return slices.Contains(o.IgnoredResourceGroups, group)
+}
+
+// isExtendedResourceName 判断是否为扩展资源：带域名前缀、不在 kubernetes.io 域下且不以 requests. 开头
+func isExtendedResourceName(name v1.ResourceName) bool {
+	domain, _, ok := strings.Cut(string(name), "/")
+	if !ok || domain == "kubernetes.io" || strings.HasSuffix(domain, ".kubernetes.io") {
+		return false
+	}
+	return !strings.HasPrefix(string(name), v1.DefaultResourceRequestsPrefix)
+}
+
+// checkers 返回 Options 选中的 Checker，名称未注册时报错
+func (o *Options) checkers() ([]Checker, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, name := range slices.Concat(o.Enabled, o.Disabled) {
+		if !slices.ContainsFunc(registry, func(c Checker) bool { return c.Name() == name }) {
+			return nil, fmt.Errorf("unknown checker %s", name)
+		}
+	}
+	var ans []Checker
+	for _, c := range registry {
+		if len(o.Enabled) > 0 && !slices.Contains(o.Enabled, c.Name()) {
+			continue
+		}
+		if slices.Contains(o.Disabled, c.Name()) {
+			continue
+		}
+		ans = append(ans, c)
+	}
+	return ans, nil
+}
@@ -0,0 +1,201 @@
+package ypd
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// 内置 Checker 的名称与上游 kube-scheduler 的 filter 插件对应
+const (
+	CheckerNodeResourcesFit   = "NodeResourcesFit"
+	CheckerNodeHealth         = "NodeHealth"
+	CheckerTaintToleration    = "TaintToleration"
+	CheckerNodeAffinity       = "NodeAffinity"
+	CheckerNodePorts          = "NodePorts"
+	CheckerInterPodAffinity   = "InterPodAffinity"
+	CheckerPodTopologySpread  = "PodTopologySpread"
+	CheckerVolumeBinding      = "VolumeBinding"
+	CheckerVolumeRestrictions = "VolumeRestrictions"
+	CheckerNodeVolumeLimits   = "NodeVolumeLimits"
+	CheckerDynamicResources   = "DynamicResources"
+)
+
+func init() {
+	registerBuiltin(CheckerNodeResourcesFit, checkNodeResourcesFit)
+	registerBuiltin(CheckerNodeHealth, checkNodeHealth)
+	registerBuiltin(CheckerTaintToleration, checkTaintToleration)
+	registerBuiltin(CheckerNodeAffinity, checkNodeAffinity)
+	registerBuiltin(CheckerNodePorts, checkNodePorts)
+	registerBuiltin(CheckerInterPodAffinity, checkInterPodAffinity)
+	registerBuiltin(CheckerPodTopologySpread, checkPodTopologySpread)
+	registerBuiltin(CheckerVolumeBinding, checkVolumeBinding)
+	registerBuiltin(CheckerVolumeRestrictions, checkVolumeRestrictions)
+	registerBuiltin(CheckerNodeVolumeLimits, checkNodeVolumeLimits)
+	registerBuiltin(CheckerDynamicResources, checkDynamicResources)
+}
+
+func warningFindings(warnings []DetailWarning) []Finding {
+	var ans []Finding
+	for _, w := range warnings {
+		ans = append(ans, newFinding(w.Reason, SeverityWarning, nil, "%s", w.Message))
+	}
+	return ans
+}
+
+func checkNodeResourcesFit(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, r := range whyResource(in.Pod, in.NodePods, in.Node, &in.snap.opts) {
+		ans = append(ans, newFinding(ReasonResourceNotEnough, SeverityBlocking, r,
+			"insufficient %s: requested %s, %s left", r.ResourceName, r.Required.String(), r.Left.String()))
+	}
+	for _, r := range whyWillFreeSoon(in.NodePods) {
+		ans = append(ans, newFinding(ReasonResourceNotEnough, SeverityInfo, r,
+			"terminating pod %s/%s will release its resources", r.Namespace, r.PodName))
+	}
+	return ans
+}
+
+func checkNodeHealth(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, h := range whyNodeHealth(in.Pod, in.snap, in.Node) {
+		severity := SeverityInfo
+		if h.Blocking {
+			severity = SeverityBlocking
+		}
+		ans = append(ans, newFinding(ReasonNodeUnhealthy, severity, h, "%s", h.Message))
+	}
+	return ans
+}
+
+func checkTaintToleration(in *CheckInput) []Finding {
+	var ans []Finding
+	hard, soft := whyNodeTaint(in.Pod, in.snap.runtimeClass, in.Node)
+	for _, t := range hard {
+		ans = append(ans, newFinding(ReasonNodeTaintNotTolerated, SeverityBlocking, t, "untolerated taint %s", t.Taint.ToString()))
+	}
+	for _, t := range soft {
+		ans = append(ans, newFinding(ReasonNodeTaintNotTolerated, SeverityInfo, t, "untolerated PreferNoSchedule taint %s", t.Taint.ToString()))
+	}
+	return ans
+}
+
+func checkNodeAffinity(in *CheckInput) []Finding {
+	mismatches, warnings := whyNodeAffinity(in.Pod, in.snap.runtimeClass, in.Node)
+	addedMismatches, addedWarnings := whyAddedAffinity(in.snap.opts.AddedAffinity, in.Node)
+	mismatches = append(mismatches, addedMismatches...)
+	warnings = append(warnings, addedWarnings...)
+	var ans []Finding
+	for _, m := range mismatches {
+		var msg string
+		switch {
+		case m.AddedAffinity:
+			msg = "node does not match scheduler-enforced node affinity"
+		case len(m.RuntimeClass) > 0:
+			msg = "node does not match nodeSelector of runtime class " + m.RuntimeClass
+		case m.NodeSelector:
+			msg = "node does not match pod nodeSelector"
+		default:
+			msg = "node does not match node affinity term"
+		}
+		ans = append(ans, newFinding(ReasonNodeAffinityMismatch, SeverityBlocking, m, "%s", msg))
+	}
+	return append(ans, warningFindings(warnings)...)
+}
+
+func checkNodePorts(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, c := range whyHostPort(in.Pod, in.NodePods) {
+		ans = append(ans, newFinding(ReasonHostPortConflict, SeverityBlocking, c,
+			"host port %s/%s:%d is used by pod %s/%s", c.Protocol, c.HostIP, c.HostPort, c.Namespace, c.PodName))
+	}
+	return ans
+}
+
+func checkInterPodAffinity(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, m := range whyPodAffinity(in.Pod, in.snap, in.Node) {
+		if m.MissingTopologyKey {
+			ans = append(ans, newFinding(ReasonPodAffinityMismatch, SeverityBlocking, m,
+				"node has no label %s required by pod affinity", m.Term.TopologyKey))
+			continue
+		}
+		ans = append(ans, newFinding(ReasonPodAffinityMismatch, SeverityBlocking, m,
+			"no pod matches %s in topology %s=%s", m.Selector, m.Term.TopologyKey, m.TopologyValue))
+	}
+	for _, m := range whyPodAntiAffinity(in.Pod, in.snap, in.Node) {
+		ans = append(ans, newFinding(ReasonPodAntiAffinityMismatch, SeverityBlocking, m,
+			"pod %s/%s on node %s matches pod anti-affinity in topology %s=%s",
+			m.Namespace, m.PodName, m.PodNodeName, m.Term.TopologyKey, m.TopologyValue))
+	}
+	for _, m := range whyExistingPodAntiAffinity(in.Pod, in.snap, in.Node) {
+		ans = append(ans, newFinding(ReasonExistingPodAntiAffinity, SeverityBlocking, m,
+			"anti-affinity of pod %s/%s on node %s matches the pod in topology %s=%s",
+			m.Namespace, m.PodName, m.PodNodeName, m.Term.TopologyKey, m.TopologyValue))
+	}
+	return ans
+}
+
+func checkPodTopologySpread(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, m := range whyTopologySpread(in.Pod, in.snap, in.Node) {
+		if m.MissingTopologyKey {
+			ans = append(ans, newFinding(ReasonTopologySpreadMismatch, SeverityBlocking, m,
+				"node has no label %s required by topology spread constraint", m.Constraint.TopologyKey))
+			continue
+		}
+		ans = append(ans, newFinding(ReasonTopologySpreadMismatch, SeverityBlocking, m,
+			"skew %d exceeds maxSkew %d in topology %s=%s", m.Skew, m.Constraint.MaxSkew, m.Constraint.TopologyKey, m.TopologyValue))
+	}
+	return append(ans, warningFindings(in.snap.warnings)...)
+}
+
+func checkVolumeBinding(in *CheckInput) []Finding {
+	var ans []Finding
+	// 与上游 VolumeBinding 的 PreFilter 一致，这些 pvc 使所有 node 都不可调度
+	for _, d := range in.snap.blockingClaims {
+		ans = append(ans, newFinding(ReasonVolumeBindingMismatch, SeverityBlocking, d, "pvc %s: %s", d.ClaimName, d.Message))
+	}
+	for _, m := range whyVolumeBinding(in.Pod, in.snap, in.Node) {
+		ans = append(ans, newFinding(ReasonVolumeBindingMismatch, SeverityBlocking, m, "pvc %s: %s", m.ClaimName, m.Message))
+	}
+	mismatches, warnings := whyPvAffinity(in.Node, in.snap.podPVs)
+	for _, m := range mismatches {
+		ans = append(ans, newFinding(ReasonPvAffinityMismatch, SeverityBlocking, m, "node does not match node affinity of pv %s", m.PvName))
+	}
+	return append(ans, warningFindings(warnings)...)
+}
+
+func checkVolumeRestrictions(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, c := range whyVolumeConflict(in.Pod, in.snap, in.Node) {
+		// 与上游 VolumeRestrictions 一致，只有 RWOP 冲突阻止调度；RWO volume 仍挂载在其他 node 上时
+		// pod 可以调度，但会因 Multi-Attach 等待 volume 从原 node 卸载
+		severity := SeverityWarning
+		if c.AccessMode == v1.ReadWriteOncePod {
+			severity = SeverityBlocking
+		}
+		ans = append(ans, newFinding(ReasonVolumeConflict, severity, c, "pvc %s: %s", c.ClaimName, c.Message))
+	}
+	return ans
+}
+
+func checkNodeVolumeLimits(in *CheckInput) []Finding {
+	var ans []Finding
+	for _, l := range whyVolumeLimit(in.Pod, in.snap, in.Node) {
+		ans = append(ans, newFinding(ReasonVolumeLimitExceeded, SeverityBlocking, l,
+			"%s volumes: %d attached + %d required exceeds limit %d", l.Driver, l.Attached, l.Required, l.Limit))
+	}
+	return ans
+}
+
+func checkDynamicResources(in *CheckInput) []Finding {
+	var ans []Finding
+	mismatches, warnings := whyResourceClaim(in.snap, in.Node)
+	for _, m := range mismatches {
+		name := m.Claim
+		if len(m.Request) > 0 {
+			name += "/" + m.Request
+		}
+		ans = append(ans, newFinding(ReasonResourceClaimNotSatisfied, SeverityBlocking, m, "resource claim %s: %s", name, m.Message))
+	}
+	return append(ans, warningFindings(warnings)...)
+}
@@ -0,0 +1,345 @@
+package ypd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/dynamic-resource-allocation/cel"
+)
+
+// deviceID 唯一标识 ResourceSlice 中的一个 device
+type deviceID struct {
+	driver string
+	pool   string
+	device string
+}
+
+func (d deviceID) String() string {
+	return d.driver + "/" + d.pool + "/" + d.device
+}
+
+type nodeDevice struct {
+	id    deviceID
+	basic *resourceapi.BasicDevice
+}
+
+// podClaim 是待调度 pod 通过 spec.resourceClaims 引用的 ResourceClaim
+type podClaim struct {
+	// pod 内的 claim 名，以及对应的 ResourceClaim 名
+	name      string
+	claimName string
+	spec      *resourceapi.ResourceClaimSpec
+	// 已分配的 claim 只需检查分配结果是否可在 node 上使用
+	allocation *resourceapi.AllocationResult
+	// claim 无法解析的原因
+	err string
+}
+
+func (c *podClaim) String() string {
+	if len(c.claimName) > 0 {
+		return c.claimName
+	}
+	return c.name
+}
+
+// deviceRequest 统一 DeviceRequest 和 firstAvailable 中的 DeviceSubRequest
+type deviceRequest struct {
+	name            string
+	deviceClassName string
+	selectors       []resourceapi.DeviceSelector
+	allocationMode  resourceapi.DeviceAllocationMode
+	count           int64
+	adminAccess     bool
+}
+
+// podClaims 与上游 dynamicresources 插件一致：claim 由 template 生成时，
+// 其名称记录在 pod.status.resourceClaimStatuses 中，尚未生成时按 template 的 spec 分析
+func podClaims(pod *v1.Pod, cluster *Cluster) []podClaim {
+	var ans []podClaim
+	for _, prc := range pod.Spec.ResourceClaims {
+		c := podClaim{name: prc.Name}
+		switch {
+		case prc.ResourceClaimName != nil:
+			c.claimName = *prc.ResourceClaimName
+		case prc.ResourceClaimTemplateName != nil:
+			for _, s := range pod.Status.ResourceClaimStatuses {
+				if s.Name == prc.Name && s.ResourceClaimName != nil {
+					c.claimName = *s.ResourceClaimName
+				}
+			}
+			if len(c.claimName) == 0 {
+				for i := range cluster.ResourceClaimTemplates {
+					t := &cluster.ResourceClaimTemplates[i]
+					if t.Namespace == pod.Namespace && t.Name == *prc.ResourceClaimTemplateName {
+						c.spec = &t.Spec.Spec
+					}
+				}
+				if c.spec == nil {
+					c.err = fmt.Sprintf("resource claim template %s not found", *prc.ResourceClaimTemplateName)
+				}
+			}
+		default:
+			// 两者都为空时 claim 不需要分配
+			continue
+		}
+		if len(c.claimName) > 0 {
+			for i := range cluster.ResourceClaims {
+				rc := &cluster.ResourceClaims[i]
+				if rc.Namespace == pod.Namespace && rc.Name == c.claimName {
+					c.spec, c.allocation = &rc.Spec, rc.Status.Allocation
+					if rc.DeletionTimestamp != nil {
+						c.err = "resource claim is being deleted"
+					}
+				}
+			}
+			if c.spec == nil {
+				c.err = "resource claim not found"
+			}
+		}
+		ans = append(ans, c)
+	}
+	return ans
+}
+
+// allocatedDevices 返回已分配给任意 claim 的 device，admin access 的分配不独占 device
+func allocatedDevices(claims []resourceapi.ResourceClaim) map[deviceID]bool {
+	ans := map[deviceID]bool{}
+	for i := range claims {
+		alloc := claims[i].Status.Allocation
+		if alloc == nil {
+			continue
+		}
+		for _, r := range alloc.Devices.Results {
+			if r.AdminAccess != nil && *r.AdminAccess {
+				continue
+			}
+			ans[deviceID{driver: r.Driver, pool: r.Pool, device: r.Device}] = true
+		}
+	}
+	return ans
+}
+
+// latestResourceSlices 只保留每个 pool 最新 generation 的 ResourceSlice，旧的 slice 已过期
+func latestResourceSlices(slices []resourceapi.ResourceSlice) []*resourceapi.ResourceSlice {
+	type poolKey struct{ driver, pool string }
+	generations := map[poolKey]int64{}
+	for i := range slices {
+		s := &slices[i]
+		k := poolKey{s.Spec.Driver, s.Spec.Pool.Name}
+		generations[k] = max(generations[k], s.Spec.Pool.Generation)
+	}
+	var ans []*resourceapi.ResourceSlice
+	for i := range slices {
+		s := &slices[i]
+		if s.Spec.Pool.Generation == generations[poolKey{s.Spec.Driver, s.Spec.Pool.Name}] {
+			ans = append(ans, s)
+		}
+	}
+	return ans
+}
+
+// nodeDevices 返回 node 可以访问的 device，包括 node 本地的和通过 nodeSelector/allNodes 共享的
+func (s *snapshot) nodeDevices(node *v1.Node) []nodeDevice {
+	var ans []nodeDevice
+	for _, slice := range s.resourceSlices {
+		switch {
+		case slice.Spec.NodeName == node.Name, slice.Spec.AllNodes:
+		case slice.Spec.NodeSelector != nil:
+			if ok, _, _ := nodeSelectorTermsMatch(node, slice.Spec.NodeSelector.NodeSelectorTerms); !ok {
+				continue
+			}
+		default:
+			continue
+		}
+		for i := range slice.Spec.Devices {
+			d := &slice.Spec.Devices[i]
+			if d.Basic == nil {
+				continue
+			}
+			ans = append(ans, nodeDevice{
+				id:    deviceID{driver: slice.Spec.Driver, pool: slice.Spec.Pool.Name, device: d.Name},
+				basic: d.Basic,
+			})
+		}
+	}
+	return ans
+}
+
+// celSelector 编译并缓存 CEL 表达式
+func (s *snapshot) celSelector(expression string) cel.CompilationResult {
+	if r, ok := s.celCache[expression]; ok {
+		return r
+	}
+	r := cel.GetCompiler().CompileCELExpression(expression, cel.Options{})
+	s.celCache[expression] = r
+	return r
+}
+
+// whyResourceClaim 检查 pod 的每个 ResourceClaim 能否在 node 上分配到 device。
+// 与上游 allocator 不同，这里按顺序贪心分配，不回溯，也不评估 matchAttribute 约束
+func whyResourceClaim(snap *snapshot, node *v1.Node) ([]DetailResourceClaimNotSatisfied, []DetailWarning) {
+	if len(snap.podClaims) == 0 {
+		return nil, nil
+	}
+	var (
+		ans      []DetailResourceClaimNotSatisfied
+		warnings []DetailWarning
+		devices  = snap.nodeDevices(node)
+		// 本次模拟中已分配给前面 request 的 device
+		used = map[deviceID]bool{}
+	)
+	for i := range snap.podClaims {
+		c := &snap.podClaims[i]
+		if len(c.err) > 0 {
+			ans = append(ans, DetailResourceClaimNotSatisfied{Claim: c.String(), Message: c.err})
+			continue
+		}
+		if c.allocation != nil {
+			if ns := c.allocation.NodeSelector; ns != nil {
+				if ok, _, _ := nodeSelectorTermsMatch(node, ns.NodeSelectorTerms); !ok {
+					ans = append(ans, DetailResourceClaimNotSatisfied{
+						Claim:   c.String(),
+						Message: "resource claim is allocated to devices not available on this node",
+					})
+				}
+			}
+			continue
+		}
+		if len(c.spec.Devices.Constraints) > 0 {
+			warnings = append(warnings, newWarning(ReasonResourceClaimNotSatisfied, "constraints of resource claim %s are not evaluated", c))
+		}
+		for _, r := range c.spec.Devices.Requests {
+			d, w := snap.allocateDeviceRequest(c, &r, devices, used)
+			warnings = append(warnings, w...)
+			if d != nil {
+				ans = append(ans, *d)
+			}
+		}
+	}
+	return ans, warnings
+}
+
+// allocateDeviceRequest 为 request 分配 device，有 firstAvailable 时按顺序尝试各个 subRequest
+func (s *snapshot) allocateDeviceRequest(c *podClaim, r *resourceapi.DeviceRequest, devices []nodeDevice, used map[deviceID]bool) (*DetailResourceClaimNotSatisfied, []DetailWarning) {
+	if len(r.FirstAvailable) == 0 {
+		return s.allocateDevices(c, deviceRequest{
+			name:            r.Name,
+			deviceClassName: r.DeviceClassName,
+			selectors:       r.Selectors,
+			allocationMode:  r.AllocationMode,
+			count:           r.Count,
+			adminAccess:     r.AdminAccess != nil && *r.AdminAccess,
+		}, devices, used)
+	}
+	var (
+		messages []string
+		warnings []DetailWarning
+	)
+	for _, sub := range r.FirstAvailable {
+		d, w := s.allocateDevices(c, deviceRequest{
+			name:            r.Name + "/" + sub.Name,
+			deviceClassName: sub.DeviceClassName,
+			selectors:       sub.Selectors,
+			allocationMode:  sub.AllocationMode,
+			count:           sub.Count,
+		}, devices, used)
+		warnings = append(warnings, w...)
+		if d == nil {
+			return nil, warnings
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s", sub.Name, d.Message))
+	}
+	return &DetailResourceClaimNotSatisfied{
+		Claim:   c.String(),
+		Request: r.Name,
+		Message: "no subrequest can be satisfied: " + strings.Join(messages, "; "),
+	}, warnings
+}
+
+func (s *snapshot) allocateDevices(c *podClaim, r deviceRequest, devices []nodeDevice, used map[deviceID]bool) (*DetailResourceClaimNotSatisfied, []DetailWarning) {
+	var warnings []DetailWarning
+	notSatisfied := func(format string, args ...any) *DetailResourceClaimNotSatisfied {
+		return &DetailResourceClaimNotSatisfied{
+			Claim:       c.String(),
+			Request:     r.name,
+			DeviceClass: r.deviceClassName,
+			Message:     fmt.Sprintf(format, args...),
+		}
+	}
+	class, ok := s.name2deviceClass[r.deviceClassName]
+	if !ok {
+		return notSatisfied("device class %s not found", r.deviceClassName), nil
+	}
+	selectors := slices.Concat(class.Spec.Selectors, r.selectors)
+	var matched, available []deviceID
+	for _, d := range devices {
+		match := true
+		for _, sel := range selectors {
+			if sel.CEL == nil {
+				continue
+			}
+			prog := s.celSelector(sel.CEL.Expression)
+			if prog.Error != nil {
+				return notSatisfied("invalid CEL selector %q: %v", sel.CEL.Expression, prog.Error), nil
+			}
+			ok, _, err := prog.DeviceMatches(context.Background(), cel.Device{
+				Driver:     d.id.driver,
+				Attributes: d.basic.Attributes,
+				Capacity:   d.basic.Capacity,
+			})
+			if err != nil {
+				warnings = append(warnings, newWarning(ReasonResourceClaimNotSatisfied, "CEL selector %q failed on device %s: %v", sel.CEL.Expression, d.id, err))
+			}
+			if !ok {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		matched = append(matched, d.id)
+		// admin access 可以使用已分配的 device
+		if r.adminAccess || (!s.allocatedDevices[d.id] && !used[d.id]) {
+			available = append(available, d.id)
+		}
+	}
+
+	ans := &DetailResourceClaimNotSatisfied{
+		Claim:       c.String(),
+		Request:     r.name,
+		DeviceClass: r.deviceClassName,
+		Matched:     len(matched),
+		Available:   len(available),
+	}
+	switch r.allocationMode {
+	case resourceapi.DeviceAllocationModeAll:
+		ans.Required = len(matched)
+		if len(matched) == 0 {
+			ans.Message = "no device matches the selectors"
+			return ans, warnings
+		}
+		if len(available) < len(matched) {
+			ans.Message = "allocationMode All requires all matching devices, some are already allocated"
+			return ans, warnings
+		}
+	default:
+		count := max(r.count, 1)
+		ans.Required = int(count)
+		if int64(len(available)) < count {
+			ans.Message = fmt.Sprintf("%d devices required, %d match the selectors, %d of them are available", count, len(matched), len(available))
+			return ans, warnings
+		}
+		available = available[:count]
+	}
+	if !r.adminAccess {
+		for _, id := range available {
+			used[id] = true
+		}
+	}
+	return nil, warnings
+}
@@ -0,0 +1,218 @@
+package ypd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const eventReasonFailedScheduling = "FailedScheduling"
+
+var (
+	// 上游 FitError 的格式为 "0/N nodes are available: <PreFilterMsg>. <FilterMsg>. <PostFilterMsg>"
+	failedSchedulingPattern = regexp.MustCompile(`^0/(\d+) nodes are available: (.*)$`)
+	eventReasonCountPattern = regexp.MustCompile(`^(\d+) (.+)$`)
+	eventTaintPattern       = regexp.MustCompile(`^node\(s\) had untolerated taint \{(.*): .*\}$`)
+)
+
+// eventReasonPrefixes 将上游插件的原因对应到 ypd 的 Reason，按前缀匹配
+var eventReasonPrefixes = []struct {
+	prefix string
+	reason Reason
+}{
+	{"Insufficient ", ReasonResourceNotEnough},
+	{"Too many pods", ReasonResourceNotEnough},
+	{"node(s) had untolerated taint", ReasonNodeTaintNotTolerated},
+	{"node(s) had taints that the pod didn't tolerate", ReasonNodeTaintNotTolerated},
+	{"node(s) were unschedulable", ReasonNodeUnhealthy},
+	{"node(s) didn't match Pod's node affinity/selector", ReasonNodeAffinityMismatch},
+	{"node(s) didn't match scheduler-enforced node affinity", ReasonNodeAffinityMismatch},
+	{"node(s) didn't have free ports", ReasonHostPortConflict},
+	{"node(s) didn't match pod affinity rules", ReasonPodAffinityMismatch},
+	{"node(s) didn't match pod anti-affinity rules", ReasonPodAntiAffinityMismatch},
+	{"node(s) didn't satisfy existing pods anti-affinity rules", ReasonExistingPodAntiAffinity},
+	{"node(s) didn't match pod topology spread constraints", ReasonTopologySpreadMismatch},
+	{"node(s) had volume node affinity conflict", ReasonPvAffinityMismatch},
+	{"node(s) didn't match PersistentVolume's node affinity", ReasonPvAffinityMismatch},
+	{"node(s) had no available volume zone", ReasonPvAffinityMismatch},
+	{"node(s) didn't find available persistent volumes to bind", ReasonVolumeBindingMismatch},
+	{"node(s) did not have enough free storage", ReasonVolumeBindingMismatch},
+	{"node(s) unavailable due to one or more pvc(s) bound to non-existent pv(s)", ReasonVolumeBindingMismatch},
+	{"pod has unbound immediate PersistentVolumeClaims", ReasonVolumeBindingMismatch},
+	{"node(s) had no available disk", ReasonVolumeConflict},
+	{"node has pod using PersistentVolumeClaim with the same name and ReadWriteOncePod access mode", ReasonVolumeConflict},
+	{"node(s) exceed max volume count", ReasonVolumeLimitExceeded},
+	{"cannot allocate all claims", ReasonResourceClaimNotSatisfied},
+	{"resourceclaim not available on the node", ReasonResourceClaimNotSatisfied},
+}
+
+// WhySchedulingEvent 解析 pod 最近一次 FailedScheduling event 中各原因的 node 数，与 ypd 的结论 ans 对照。
+// 没有可以解析的 event 时返回 nil
+func WhySchedulingEvent(pod *v1.Pod, cluster *Cluster, ans []Detail) *DetailSchedulingEvent {
+	if pod == nil || cluster == nil {
+		return nil
+	}
+	var event *DetailEvent
+	for _, e := range objectEvents(cluster.Events, "Pod", pod.Namespace, pod.Name) {
+		if e.Reason == eventReasonFailedScheduling {
+			event = &e
+		}
+	}
+	if event == nil {
+		return nil
+	}
+	nodes, reasons, ok := parseFailedScheduling(event.Message)
+	if !ok {
+		return nil
+	}
+	d := &DetailSchedulingEvent{
+		Event:    *event,
+		Nodes:    nodes,
+		YpdNodes: len(ans),
+		Reasons:  reasons,
+	}
+	for i := range ans {
+		if ans[i].Schedulable {
+			d.YpdSchedulableNodes++
+		}
+	}
+	for i := range d.Reasons {
+		r := &d.Reasons[i]
+		if len(r.Reason) == 0 {
+			continue
+		}
+		r.YpdNodes = countYpdNodes(ans, r.Reason, r.Key)
+		if r.EventNodes > r.YpdNodes {
+			r.Disagree = true
+			d.Disagreements = append(d.Disagreements, fmt.Sprintf("scheduler reports %d node(s) with %q, ypd finds %d", r.EventNodes, r.Message, r.YpdNodes))
+		}
+	}
+	// ypd 发现而 event 中没有的原因，可能被调度器更早失败的插件掩盖
+	for _, reason := range ypdReasons(ans) {
+		if !slices.ContainsFunc(d.Reasons, func(r DetailEventReason) bool { return r.Reason == reason }) {
+			d.Reasons = append(d.Reasons, DetailEventReason{Reason: reason, YpdNodes: countYpdNodes(ans, reason, "")})
+		}
+	}
+	if d.Nodes != d.YpdNodes {
+		d.Disagreements = append(d.Disagreements, fmt.Sprintf("scheduler saw %d node(s), ypd sees %d: the cluster changed since the event", d.Nodes, d.YpdNodes))
+	}
+	if d.YpdSchedulableNodes > 0 {
+		d.Disagreements = append(d.Disagreements, fmt.Sprintf("ypd finds %d schedulable node(s) while the scheduler found none", d.YpdSchedulableNodes))
+	}
+	return d
+}
+
+// parseFailedScheduling 解析 FailedScheduling event 的 message，返回 node 总数和各原因的 node 数。
+// PreFilter 失败时原因不带 node 数，视为所有 node
+func parseFailedScheduling(message string) (int, []DetailEventReason, bool) {
+	m := failedSchedulingPattern.FindStringSubmatch(strings.TrimSpace(message))
+	if m == nil {
+		return 0, nil, false
+	}
+	nodes, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, nil, false
+	}
+	msg, _, _ := strings.Cut(m[2], " preemption:")
+	msg = strings.TrimSuffix(strings.TrimSpace(msg), ".")
+
+	var ans []DetailEventReason
+	for _, item := range splitEventReasons(msg) {
+		r := DetailEventReason{Message: item, EventNodes: nodes}
+		if m := eventReasonCountPattern.FindStringSubmatch(item); m != nil {
+			r.EventNodes, _ = strconv.Atoi(m[1])
+			r.Message = m[2]
+		}
+		r.Reason, r.Key = eventReason(r.Message)
+		ans = append(ans, r)
+	}
+	return nodes, ans, true
+}
+
+// splitEventReasons 按 ", " 和 ". " 拆分原因，跳过 taint 等 {} 内的内容
+func splitEventReasons(msg string) []string {
+	var (
+		ans   []string
+		depth int
+		start int
+	)
+	for i := 0; i < len(msg); i++ {
+		switch msg[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',', '.':
+			if depth == 0 && i+1 < len(msg) && msg[i+1] == ' ' {
+				if item := strings.TrimSpace(msg[start:i]); len(item) > 0 {
+					ans = append(ans, item)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if item := strings.TrimSpace(msg[start:]); len(item) > 0 {
+		ans = append(ans, item)
+	}
+	return ans
+}
+
+// eventReason 返回上游原因对应的 ypd Reason，以及资源名或 taint key
+func eventReason(message string) (Reason, string) {
+	for _, p := range eventReasonPrefixes {
+		if !strings.HasPrefix(message, p.prefix) {
+			continue
+		}
+		switch {
+		case message == "Too many pods":
+			return p.reason, string(v1.ResourcePods)
+		case p.reason == ReasonResourceNotEnough:
+			return p.reason, strings.TrimPrefix(message, p.prefix)
+		case p.reason == ReasonNodeTaintNotTolerated:
+			if m := eventTaintPattern.FindStringSubmatch(message); m != nil {
+				return p.reason, m[1]
+			}
+		}
+		return p.reason, ""
+	}
+	return "", ""
+}
+
+// countYpdNodes 返回 ypd 认为因 reason 无法调度的 node 数，key 非空时还要求资源名或 taint key 相同
+func countYpdNodes(ans []Detail, reason Reason, key string) int {
+	var count int
+	for i := range ans {
+		if slices.ContainsFunc(ans[i].Findings, func(f Finding) bool {
+			if f.Severity != SeverityBlocking || f.Reason != reason {
+				return false
+			}
+			switch data := f.Data.(type) {
+			case DetailResourceNotEnough:
+				return len(key) == 0 || data.ResourceName == key
+			case DetailTaintNotTolerated:
+				return len(key) == 0 || data.Taint.Key == key
+			}
+			return true
+		}) {
+			count++
+		}
+	}
+	return count
+}
+
+// ypdReasons 按出现顺序返回 ans 中所有阻止调度的原因
+func ypdReasons(ans []Detail) []Reason {
+	var reasons []Reason
+	for i := range ans {
+		for _, f := range ans[i].Findings {
+			if f.Severity == SeverityBlocking && !slices.Contains(reasons, f.Reason) {
+				reasons = append(reasons, f.Reason)
+			}
+		}
+	}
+	return reasons
+}
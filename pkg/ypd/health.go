@@ -0,0 +1,102 @@
+package ypd
+
+import (
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodeLeaseGracePeriod 对应 kube-controller-manager 的 --node-monitor-grace-period 默认值
+const nodeLeaseGracePeriod = 40 * time.Second
+
+// nodeConditionHealth 描述 node condition 处于何种状态时不健康，以及 node lifecycle controller 对应添加的 taint
+var nodeConditionHealth = []struct {
+	condition v1.NodeConditionType
+	status    v1.ConditionStatus
+	health    NodeHealthType
+	taintKey  string
+}{
+	{v1.NodeReady, v1.ConditionFalse, NodeHealthNotReady, v1.TaintNodeNotReady},
+	{v1.NodeReady, v1.ConditionUnknown, NodeHealthNotReady, v1.TaintNodeUnreachable},
+	{v1.NodeNetworkUnavailable, v1.ConditionTrue, NodeHealthNetworkUnavailable, v1.TaintNodeNetworkUnavailable},
+	{v1.NodeMemoryPressure, v1.ConditionTrue, NodeHealthMemoryPressure, v1.TaintNodeMemoryPressure},
+	{v1.NodeDiskPressure, v1.ConditionTrue, NodeHealthDiskPressure, v1.TaintNodeDiskPressure},
+	{v1.NodePIDPressure, v1.ConditionTrue, NodeHealthPIDPressure, v1.TaintNodePIDPressure},
+}
+
+func whyNodeHealth(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailNodeHealth {
+	var ans []DetailNodeHealth
+
+	// 1. 检查 cordon
+	if node.Spec.Unschedulable {
+		d := DetailNodeHealth{
+			Type:     NodeHealthCordoned,
+			Message:  "node is cordoned",
+			Blocking: !toleratesConditionTaint(pod, snap.runtimeClass, v1.TaintNodeUnschedulable),
+		}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == v1.TaintNodeUnschedulable && taint.TimeAdded != nil {
+				d.LastTransitionTime = *taint.TimeAdded
+			}
+		}
+		ans = append(ans, d)
+	}
+
+	// 2. 检查 node conditions，调度器不看 condition，只通过 node lifecycle controller 添加的 taint 阻止调度，
+	// taint 尚未添加时仅供参考
+	for _, cond := range node.Status.Conditions {
+		for _, h := range nodeConditionHealth {
+			if cond.Type != h.condition || cond.Status != h.status {
+				continue
+			}
+			ans = append(ans, DetailNodeHealth{
+				Type:               h.health,
+				Message:            fmt.Sprintf("%s=%s: %s", cond.Type, cond.Status, cond.Message),
+				LastTransitionTime: cond.LastTransitionTime,
+				Blocking:           hasUntoleratedTaint(pod, snap.runtimeClass, node, h.taintKey),
+			})
+		}
+	}
+
+	// 3. 检查 node lease，kubelet 停止续约后 node 很快会变为 NotReady
+	if lease, ok := snap.name2lease[node.Name]; ok && lease.Spec.RenewTime != nil {
+		renewTime := lease.Spec.RenewTime.Time
+		if age := snap.now.Sub(renewTime); age > nodeLeaseGracePeriod {
+			ans = append(ans, DetailNodeHealth{
+				Type:               NodeHealthStaleLease,
+				Message:            fmt.Sprintf("node lease not renewed for %s", age.Truncate(time.Second)),
+				LastTransitionTime: metav1.NewTime(renewTime),
+			})
+		}
+	}
+	return ans
+}
+
+func toleratesConditionTaint(pod *v1.Pod, rc *nodev1.RuntimeClass, taintKey string) bool {
+	return toleratesTaint(podTolerations(pod, rc), v1.Taint{Key: taintKey, Effect: v1.TaintEffectNoSchedule})
+}
+
+// hasUntoleratedTaint 判断 node 上是否有 pod 不能容忍的 taintKey NoSchedule 或 NoExecute taint
+func hasUntoleratedTaint(pod *v1.Pod, rc *nodev1.RuntimeClass, node *v1.Node, taintKey string) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key != taintKey || (taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute) {
+			continue
+		}
+		if !toleratesTaint(podTolerations(pod, rc), taint) {
+			return true
+		}
+	}
+	return false
+}
+
+func leasesByName(leases []coordinationv1.Lease) map[string]*coordinationv1.Lease {
+	ans := map[string]*coordinationv1.Lease{}
+	for i := range leases {
+		ans[leases[i].Name] = &leases[i]
+	}
+	return ans
+}
@@ -0,0 +1,80 @@
+package ypd
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+const defaultBindAllHostIP = "0.0.0.0"
+
+// hostPort 是 pod 占用的一个 (protocol, hostIP, port)
+type hostPort struct {
+	Protocol string
+	HostIP   string
+	Port     int32
+}
+
+// podHostPorts 返回 pod 的业务容器占用的 host port。与上游 NodePorts 一致，
+// 不计算 init 容器和 sidecar 的端口，protocol 默认为 TCP，hostIP 默认为 0.0.0.0
+func podHostPorts(pod *v1.Pod) []hostPort {
+	var ans []hostPort
+	add := func(c *v1.Container) {
+		for _, p := range c.Ports {
+			port := p.HostPort
+			// hostNetwork 的 pod，hostPort 未填时由 apiserver 默认为 containerPort
+			if port <= 0 && pod.Spec.HostNetwork {
+				port = p.ContainerPort
+			}
+			if port <= 0 {
+				continue
+			}
+			hp := hostPort{Protocol: string(p.Protocol), HostIP: p.HostIP, Port: port}
+			if len(hp.Protocol) == 0 {
+				hp.Protocol = string(v1.ProtocolTCP)
+			}
+			if len(hp.HostIP) == 0 {
+				hp.HostIP = defaultBindAllHostIP
+			}
+			ans = append(ans, hp)
+		}
+	}
+	for i := range pod.Spec.Containers {
+		add(&pod.Spec.Containers[i])
+	}
+	return ans
+}
+
+// conflicts 与上游 HostPortInfo.CheckConflict 一致：0.0.0.0 与任意 hostIP 的同一端口冲突
+func (p hostPort) conflicts(other hostPort) bool {
+	if p.Protocol != other.Protocol || p.Port != other.Port {
+		return false
+	}
+	return p.HostIP == defaultBindAllHostIP || other.HostIP == defaultBindAllHostIP || p.HostIP == other.HostIP
+}
+
+func whyHostPort(pod *v1.Pod, nodePods []v1.Pod) []DetailHostPortConflict {
+	wanted := podHostPorts(pod)
+	if len(wanted) == 0 {
+		return nil
+	}
+	var conflicts []DetailHostPortConflict
+	for i := range nodePods {
+		np := &nodePods[i]
+		for _, used := range podHostPorts(np) {
+			for _, w := range wanted {
+				if !w.conflicts(used) {
+					continue
+				}
+				conflicts = append(conflicts, DetailHostPortConflict{
+					Protocol:       w.Protocol,
+					HostIP:         w.HostIP,
+					HostPort:       w.Port,
+					Namespace:      np.Namespace,
+					PodName:        np.Name,
+					PodHostIP:      used.HostIP,
+					PodHostNetwork: np.Spec.HostNetwork,
+				})
+			}
+		}
+	}
+	return conflicts
+}
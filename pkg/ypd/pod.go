@@ -0,0 +1,106 @@
+package ypd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// defaultSchedulerLease 是 default-scheduler 选主使用的 lease 名
+const defaultSchedulerLease = "kube-scheduler"
+
+// WhyPod 分析与 node 无关的 pod 级别原因，存在 blocker 时 pod 根本不会进入 node 过滤阶段
+func WhyPod(pod *v1.Pod, cluster *Cluster) PodDetail {
+	if pod == nil || cluster == nil {
+		return PodDetail{}
+	}
+	ans := PodDetail{Claims: WhyStorage(pod, cluster)}
+	if gates := pod.Spec.SchedulingGates; len(gates) > 0 {
+		names := make([]string, 0, len(gates))
+		for _, g := range gates {
+			names = append(names, g.Name)
+		}
+		ans.Blockers = append(ans.Blockers, DetailPodBlocker{
+			Reason:  ReasonSchedulingGated,
+			Message: fmt.Sprintf("pod has scheduling gates %s, it will not be scheduled until they are removed", strings.Join(names, ",")),
+		})
+	}
+	if name := pod.Spec.RuntimeClassName; name != nil && len(*name) > 0 && podRuntimeClass(pod, cluster.RuntimeClasses) == nil {
+		ans.Blockers = append(ans.Blockers, DetailPodBlocker{
+			Reason:  ReasonRuntimeClassNotFound,
+			Message: fmt.Sprintf("runtime class %s not found, pod will be rejected by admission or kubelet", *name),
+		})
+	}
+	if nodeName := pod.Spec.NodeName; len(nodeName) > 0 {
+		// 指定了 nodeName 的 pod 绕过调度器，直接由 kubelet 接管
+		found := false
+		for i := range cluster.Nodes {
+			if cluster.Nodes[i].Name == nodeName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ans.Blockers = append(ans.Blockers, DetailPodBlocker{
+				Reason:  ReasonNodeNotFound,
+				Message: fmt.Sprintf("pod is bound to node %s which does not exist", nodeName),
+			})
+		}
+		return ans
+	}
+	b, w := whyScheduler(pod, cluster)
+	if b != nil {
+		ans.Blockers = append(ans.Blockers, *b)
+	}
+	if w != nil {
+		ans.Warnings = append(ans.Warnings, *w)
+	}
+	return ans
+}
+
+// whyScheduler 检查 pod 指定的调度器是否在运行：选主 lease 仍在续约，
+// 或者调度器已经为该 pod 产生过 event，都说明调度器在处理该 pod。
+// 只有 lease 存在且已过期时才确定调度器不在运行；没有 lease 也没有 event 时，
+// 调度器可能未开启选主或 lease 不可见，只返回 warning
+func whyScheduler(pod *v1.Pod, cluster *Cluster) (*DetailPodBlocker, *DetailWarning) {
+	name := pod.Spec.SchedulerName
+	if len(name) == 0 {
+		name = v1.DefaultSchedulerName
+	}
+	for _, e := range cluster.Events {
+		obj := e.InvolvedObject
+		if obj.Kind == "Pod" && obj.Namespace == pod.Namespace && obj.Name == pod.Name &&
+			(e.Source.Component == name || e.ReportingController == name) {
+			return nil, nil
+		}
+	}
+	leaseName := name
+	if name == v1.DefaultSchedulerName {
+		leaseName = defaultSchedulerLease
+	}
+	now := cluster.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for _, lease := range cluster.SchedulerLeases {
+		if lease.Name != leaseName || lease.Spec.RenewTime == nil {
+			continue
+		}
+		duration := 15 * time.Second
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+		age := now.Sub(lease.Spec.RenewTime.Time)
+		if age <= duration {
+			return nil, nil
+		}
+		return &DetailPodBlocker{
+			Reason:  ReasonSchedulerNotRunning,
+			Message: fmt.Sprintf("leader election lease %s/%s of scheduler %s not renewed for %s", lease.Namespace, lease.Name, name, age.Truncate(time.Second)),
+		}, nil
+	}
+	w := newWarning(ReasonSchedulerNotRunning, "scheduler %s has no leader election lease %s and reported no event for the pod, cannot tell whether it is running", name, leaseName)
+	return nil, &w
+}
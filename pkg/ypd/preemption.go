@@ -0,0 +1,262 @@
+package ypd
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// WhyPreemption 模拟上游 DefaultPreemption：对每个可通过驱逐低优先级 pod 变为可调度的 node，
+// 找出最小的驱逐集合，并按上游规则选出调度器会提名的 node
+func WhyPreemption(pod *v1.Pod, cluster *Cluster) *DetailPreemption {
+	ans, _ := WhyPreemptionWithOptions(pod, cluster, Options{})
+	return ans
+}
+
+// WhyPreemptionWithOptions 与 WhyPendingWithOptions 一样只运行 opts 选中的 Checker 判断 node 能否调度，
+// opts 中有未注册的 Checker 时报错
+func WhyPreemptionWithOptions(pod *v1.Pod, cluster *Cluster, opts Options) (*DetailPreemption, error) {
+	checkers, err := opts.checkers()
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil || cluster == nil {
+		return nil, nil
+	}
+	priority, policy := podPriority(pod, cluster.PriorityClasses)
+	ans := &DetailPreemption{
+		Priority:         priority,
+		PreemptionPolicy: policy,
+	}
+	if policy == v1.PreemptNever {
+		ans.Message = "pod has preemptionPolicy Never"
+		return ans, nil
+	}
+	snap := newSnapshot(pod, cluster)
+	snap.checkers = checkers
+	snap.opts = opts
+	// 与上游一致，只有没有 node 可以调度时才会运行 PostFilter 抢占
+	var nodes []*v1.Node
+	for i := range snap.nodes {
+		node := &snap.nodes[i]
+		d := whySingleNode(pod, snap, node)
+		if d.Schedulable {
+			ans.Message = "pod fits without preemption"
+			return ans, nil
+		}
+		if d.preemptionMayHelp() {
+			nodes = append(nodes, node)
+		}
+	}
+	for _, node := range nodes {
+		c, ok := selectVictims(pod, snap, node, priority, cluster)
+		if ok {
+			ans.Candidates = append(ans.Candidates, c)
+		}
+	}
+	if len(ans.Candidates) == 0 {
+		ans.Message = "no node can fit the pod by evicting lower priority pods"
+		return ans, nil
+	}
+	ans.NominatedNodeName = pickNominatedNode(ans.Candidates)
+	return ans, nil
+}
+
+// podPriority 返回 pod 的优先级和抢占策略，未经 admission 的 pod 从 PriorityClass 中解析
+func podPriority(pod *v1.Pod, classes []schedulingv1.PriorityClass) (int32, v1.PreemptionPolicy) {
+	var (
+		priority int32
+		policy   = v1.PreemptLowerPriority
+		class    *schedulingv1.PriorityClass
+	)
+	for i := range classes {
+		c := &classes[i]
+		if (len(pod.Spec.PriorityClassName) > 0 && c.Name == pod.Spec.PriorityClassName) ||
+			(len(pod.Spec.PriorityClassName) == 0 && c.GlobalDefault) {
+			class = c
+			break
+		}
+	}
+	if class != nil {
+		priority = class.Value
+		if class.PreemptionPolicy != nil {
+			policy = *class.PreemptionPolicy
+		}
+	}
+	if pod.Spec.Priority != nil {
+		priority = *pod.Spec.Priority
+	}
+	if pod.Spec.PreemptionPolicy != nil {
+		policy = *pod.Spec.PreemptionPolicy
+	}
+	return priority, policy
+}
+
+// preemptionResolvable 是可以通过驱逐 node 上的 pod 解决的原因
+var preemptionResolvable = []Reason{
+	ReasonResourceNotEnough,
+	ReasonPodAntiAffinityMismatch,
+	ReasonExistingPodAntiAffinity,
+	ReasonTopologySpreadMismatch,
+	ReasonHostPortConflict,
+	ReasonVolumeLimitExceeded,
+	ReasonVolumeConflict,
+}
+
+// preemptionMayHelp 判断 node 不可调度的原因是否都可以通过驱逐 pod 解决
+func (w *Detail) preemptionMayHelp() bool {
+	for _, f := range w.Findings {
+		if f.Severity == SeverityBlocking && !slices.Contains(preemptionResolvable, f.Reason) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectVictims 与上游 SelectVictimsOnNode 一致：先移除所有低优先级 pod，
+// 再按优先级从高到低尽量放回，优先放回会违反 PDB 的 pod
+func selectVictims(pod *v1.Pod, snap *snapshot, node *v1.Node, priority int32, cluster *Cluster) (DetailPreemptionCandidate, bool) {
+	var (
+		remaining []v1.Pod
+		potential []v1.Pod
+		ans       = DetailPreemptionCandidate{NodeName: node.Name}
+	)
+	fits := func(pods []v1.Pod) bool {
+		return whySingleNode(pod, snap.withNodePods(pod, node.Name, pods), node).Schedulable
+	}
+	for _, p := range snap.node2pods[node.Name] {
+		if pr, _ := podPriority(&p, cluster.PriorityClasses); pr < priority {
+			potential = append(potential, p)
+		} else {
+			remaining = append(remaining, p)
+		}
+	}
+	if len(potential) == 0 || !fits(remaining) {
+		return ans, false
+	}
+
+	// 重要的 pod 优先放回：优先级高的在前，优先级相同时启动早的在前
+	sort.SliceStable(potential, func(i, j int) bool {
+		pi, _ := podPriority(&potential[i], cluster.PriorityClasses)
+		pj, _ := podPriority(&potential[j], cluster.PriorityClasses)
+		if pi != pj {
+			return pi > pj
+		}
+		return podStartTime(&potential[i]).Before(podStartTime(&potential[j]))
+	})
+	violating, nonViolating := filterPodsWithPDBViolation(potential, cluster.PDBs)
+	reprieve := func(p v1.Pod, pdbs []string) {
+		if fits(append(remaining, p)) {
+			remaining = append(remaining, p)
+			return
+		}
+		pr, _ := podPriority(&p, cluster.PriorityClasses)
+		ans.Victims = append(ans.Victims, DetailVictim{
+			Namespace:   p.Namespace,
+			PodName:     p.Name,
+			Priority:    pr,
+			ViolatesPDB: pdbs,
+		})
+		if len(pdbs) > 0 {
+			ans.PDBViolations++
+		}
+	}
+	for _, v := range violating {
+		reprieve(v.pod, v.pdbs)
+	}
+	for _, v := range nonViolating {
+		reprieve(v.pod, nil)
+	}
+	return ans, true
+}
+
+func podStartTime(pod *v1.Pod) *metav1.Time {
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime
+	}
+	return &pod.CreationTimestamp
+}
+
+type pdbVictim struct {
+	pod  v1.Pod
+	pdbs []string
+}
+
+// filterPodsWithPDBViolation 按顺序扣减 PDB 的 disruptionsAllowed，扣到负数的 pod 会违反 PDB
+func filterPodsWithPDBViolation(pods []v1.Pod, pdbs []policyv1.PodDisruptionBudget) ([]pdbVictim, []pdbVictim) {
+	var (
+		violating    []pdbVictim
+		nonViolating []pdbVictim
+		allowed      = make([]int32, len(pdbs))
+	)
+	for i := range pdbs {
+		allowed[i] = pdbs[i].Status.DisruptionsAllowed
+	}
+	for _, p := range pods {
+		var violated []string
+		for i := range pdbs {
+			pdb := &pdbs[i]
+			if pdb.Namespace != p.Namespace {
+				continue
+			}
+			sel, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			// 空 selector 不匹配任何 pod
+			if err != nil || sel.Empty() || !sel.Matches(labels.Set(p.Labels)) {
+				continue
+			}
+			// 已被驱逐过的 pod 不再扣减
+			if _, ok := pdb.Status.DisruptedPods[p.Name]; ok {
+				continue
+			}
+			allowed[i]--
+			if allowed[i] < 0 {
+				violated = append(violated, pdb.Name)
+			}
+		}
+		if len(violated) > 0 {
+			violating = append(violating, pdbVictim{pod: p, pdbs: violated})
+		} else {
+			nonViolating = append(nonViolating, pdbVictim{pod: p})
+		}
+	}
+	return violating, nonViolating
+}
+
+// pickNominatedNode 与上游 pickOneNodeForPreemption 一致，依次比较：
+// PDB 违反数最少、最高优先级 victim 的优先级最低、victim 优先级之和最小、victim 数最少
+func pickNominatedNode(candidates []DetailPreemptionCandidate) string {
+	type score struct {
+		violations  int
+		highest     int32
+		sum         int64
+		victimCount int
+	}
+	scoreOf := func(c *DetailPreemptionCandidate) score {
+		s := score{violations: c.PDBViolations, highest: math.MinInt32, victimCount: len(c.Victims)}
+		for _, v := range c.Victims {
+			s.highest = max(s.highest, v.Priority)
+			// 与上游一致，加上 MaxInt32+1 使负优先级也参与比较
+			s.sum += int64(v.Priority) + math.MaxInt32 + 1
+		}
+		return s
+	}
+	best, bestScore := 0, scoreOf(&candidates[0])
+	for i := 1; i < len(candidates); i++ {
+		s := scoreOf(&candidates[i])
+		less := s.violations < bestScore.violations ||
+			(s.violations == bestScore.violations && s.highest < bestScore.highest) ||
+			(s.violations == bestScore.violations && s.highest == bestScore.highest && s.sum < bestScore.sum) ||
+			(s.violations == bestScore.violations && s.highest == bestScore.highest && s.sum == bestScore.sum &&
+				s.victimCount < bestScore.victimCount)
+		if less {
+			best, bestScore = i, s
+		}
+	}
+	return candidates[best].NodeName
+}
@@ -0,0 +1,48 @@
+package ypd
+
+import (
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+)
+
+// podRuntimeClass 返回 pod 引用的 RuntimeClass，未指定或不存在时返回 nil
+func podRuntimeClass(pod *v1.Pod, classes []nodev1.RuntimeClass) *nodev1.RuntimeClass {
+	name := pod.Spec.RuntimeClassName
+	if name == nil || len(*name) == 0 {
+		return nil
+	}
+	for i := range classes {
+		if classes[i].Name == *name {
+			return &classes[i]
+		}
+	}
+	return nil
+}
+
+// podTolerations 与 RuntimeClass admission 一致，将 scheduling.tolerations 追加到 pod 的 toleration 中
+func podTolerations(pod *v1.Pod, rc *nodev1.RuntimeClass) []v1.Toleration {
+	if rc == nil || rc.Scheduling == nil || len(rc.Scheduling.Tolerations) == 0 {
+		return pod.Spec.Tolerations
+	}
+	ans := make([]v1.Toleration, 0, len(pod.Spec.Tolerations)+len(rc.Scheduling.Tolerations))
+	return append(append(ans, pod.Spec.Tolerations...), rc.Scheduling.Tolerations...)
+}
+
+// runtimeClassNodeSelector 返回 RuntimeClass 的 scheduling.nodeSelector 中 pod 尚未包含的部分，
+// 已经过 admission 的 pod 会在 nodeSelector 检查中报告，避免重复
+func runtimeClassNodeSelector(pod *v1.Pod, rc *nodev1.RuntimeClass) map[string]string {
+	if rc == nil || rc.Scheduling == nil {
+		return nil
+	}
+	var ans map[string]string
+	for k, v := range rc.Scheduling.NodeSelector {
+		if pv, ok := pod.Spec.NodeSelector[k]; ok && pv == v {
+			continue
+		}
+		if ans == nil {
+			ans = map[string]string{}
+		}
+		ans[k] = v
+	}
+	return ans
+}
@@ -0,0 +1,305 @@
+package ypd
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/dynamic-resource-allocation/cel"
+)
+
+// snapshot 是一次分析用到的集群状态，按 node 和拓扑域索引 pod
+type snapshot struct {
+	cluster *Cluster
+	// 分析每个 node 时运行的 Checker 及插件参数
+	checkers  []Checker
+	opts      Options
+	nodes     []v1.Node
+	name2node map[string]*v1.Node
+	node2pods map[string][]v1.Pod
+	// namespace -> namespace 的 labels
+	ns2labels map[string]labels.Set
+	// node 名 -> node lease
+	name2lease map[string]*coordinationv1.Lease
+	now        time.Time
+	// namespace/name -> pvc
+	name2pvc     map[string]*v1.PersistentVolumeClaim
+	name2pv      map[string]*v1.PersistentVolume
+	name2sc      map[string]*storagev1.StorageClass
+	name2csinode map[string]*storagev1.CSINode
+	// 待调度 pod 的 pvc 绑定的 pv
+	podPVs []v1.PersistentVolume
+	// 待调度 pod 的 pvc 中使 pod 在所有 node 上都无法调度的 pvc
+	blockingClaims []DetailPvc
+	// namespace/pvc 名 -> 使用该 pvc 的其他 pod
+	claimUsers map[string][]*v1.Pod
+	// pv 名 -> 该 pv 的 VolumeAttachment
+	pv2attachments map[string][]*storagev1.VolumeAttachment
+	// 待调度 pod 的 RuntimeClass，未指定或不存在时为 nil
+	runtimeClass *nodev1.RuntimeClass
+	// 待调度 pod 的 ResourceClaim 以及分配 device 所需的索引
+	podClaims        []podClaim
+	name2deviceClass map[string]*resourcev1beta1.DeviceClass
+	resourceSlices   []*resourcev1beta1.ResourceSlice
+	allocatedDevices map[deviceID]bool
+	celCache         map[string]cel.CompilationResult
+	// topologyKey -> topologyValue -> 该拓扑域内的 node
+	domains map[string]map[string][]*v1.Node
+	// 待调度 pod 的拓扑分布约束及各拓扑域计数
+	spreadConstraints []spreadConstraint
+	// 拓扑域 -> anti-affinity 排斥待调度 pod 的已有 pod，对应上游 existingAntiAffinityCounts
+	existingAntiAffinity map[topologyPair][]DetailExistingPodAntiAffinity
+	warnings             []DetailWarning
+}
+
+// topologyPair 是拓扑域 key=value
+type topologyPair struct {
+	key   string
+	value string
+}
+
+func newSnapshot(pod *v1.Pod, cluster *Cluster) *snapshot {
+	checkers, _ := (&Options{}).checkers()
+	s := &snapshot{
+		cluster:          cluster,
+		checkers:         checkers,
+		nodes:            cluster.Nodes,
+		name2node:        map[string]*v1.Node{},
+		node2pods:        map[string][]v1.Pod{},
+		ns2labels:        map[string]labels.Set{},
+		name2lease:       leasesByName(cluster.Leases),
+		now:              cluster.Now,
+		name2pvc:         map[string]*v1.PersistentVolumeClaim{},
+		name2pv:          map[string]*v1.PersistentVolume{},
+		name2sc:          map[string]*storagev1.StorageClass{},
+		name2csinode:     map[string]*storagev1.CSINode{},
+		pv2attachments:   map[string][]*storagev1.VolumeAttachment{},
+		runtimeClass:     podRuntimeClass(pod, cluster.RuntimeClasses),
+		podClaims:        podClaims(pod, cluster),
+		name2deviceClass: map[string]*resourcev1beta1.DeviceClass{},
+		resourceSlices:   latestResourceSlices(cluster.ResourceSlices),
+		allocatedDevices: allocatedDevices(cluster.ResourceClaims),
+		celCache:         map[string]cel.CompilationResult{},
+		domains:          map[string]map[string][]*v1.Node{},
+	}
+	if s.now.IsZero() {
+		s.now = time.Now()
+	}
+	for i := range s.nodes {
+		s.name2node[s.nodes[i].Name] = &s.nodes[i]
+	}
+	for _, ns := range cluster.Namespaces {
+		s.ns2labels[ns.Name] = ns.Labels
+	}
+	for i := range cluster.PVCs {
+		pvc := &cluster.PVCs[i]
+		s.name2pvc[pvc.Namespace+"/"+pvc.Name] = pvc
+	}
+	for i := range cluster.PVs {
+		s.name2pv[cluster.PVs[i].Name] = &cluster.PVs[i]
+	}
+	for i := range cluster.StorageClasses {
+		s.name2sc[cluster.StorageClasses[i].Name] = &cluster.StorageClasses[i]
+	}
+	for i := range cluster.CSINodes {
+		s.name2csinode[cluster.CSINodes[i].Name] = &cluster.CSINodes[i]
+	}
+	s.podPVs = podPVs(pod, s)
+	for _, d := range whyStorage(pod, s) {
+		if d.Blocking {
+			s.blockingClaims = append(s.blockingClaims, d)
+		}
+	}
+	for i := range cluster.VolumeAttachments {
+		va := &cluster.VolumeAttachments[i]
+		if pvName := va.Spec.Source.PersistentVolumeName; pvName != nil {
+			s.pv2attachments[*pvName] = append(s.pv2attachments[*pvName], va)
+		}
+	}
+	for i := range cluster.DeviceClasses {
+		s.name2deviceClass[cluster.DeviceClasses[i].Name] = &cluster.DeviceClasses[i]
+	}
+	for _, p := range cluster.Pods {
+		// 已结束的 pod 不再占用调度资源
+		if isTerminalPod(&p) {
+			continue
+		}
+		// 待调度的 pod 自身不算在内
+		if p.Namespace == pod.Namespace && p.Name == pod.Name {
+			continue
+		}
+		if n := p.Spec.NodeName; len(n) > 0 {
+			s.node2pods[n] = append(s.node2pods[n], p)
+		}
+	}
+	s.index(pod)
+	return s
+}
+
+// index 计算依赖 node 上 pod 的索引
+func (s *snapshot) index(pod *v1.Pod) {
+	s.claimUsers = map[string][]*v1.Pod{}
+	for _, nodePods := range s.node2pods {
+		for i := range nodePods {
+			p := &nodePods[i]
+			for _, claimName := range podClaimNames(p) {
+				key := p.Namespace + "/" + claimName
+				s.claimUsers[key] = append(s.claimUsers[key], p)
+			}
+		}
+	}
+	s.spreadConstraints, s.warnings = newSpreadConstraints(pod, s)
+	s.existingAntiAffinity = map[topologyPair][]DetailExistingPodAntiAffinity{}
+	for nodeName, nodePods := range s.node2pods {
+		node, ok := s.name2node[nodeName]
+		if !ok {
+			continue
+		}
+		for _, m := range existingAntiAffinity(pod, s, node, nodePods) {
+			pair := topologyPair{key: m.Term.TopologyKey, value: m.TopologyValue}
+			s.existingAntiAffinity[pair] = append(s.existingAntiAffinity[pair], m)
+		}
+	}
+}
+
+// withNodePods 返回将 node 上的 pod 替换为 pods 后的 snapshot，用于模拟抢占。
+// 与上游 PreFilterExtensions 的 AddPod/RemovePod 一致，只更新该 node 上 pod 变化带来的增量，
+// 被修改的索引先复制，不影响 s
+func (s *snapshot) withNodePods(pod *v1.Pod, nodeName string, pods []v1.Pod) *snapshot {
+	ans := *s
+	old := s.node2pods[nodeName]
+	ans.node2pods = maps.Clone(s.node2pods)
+	ans.node2pods[nodeName] = pods
+
+	onNode := func(p *v1.Pod) bool { return p.Spec.NodeName == nodeName }
+	ans.claimUsers = maps.Clone(s.claimUsers)
+	for i := range old {
+		for _, claimName := range podClaimNames(&old[i]) {
+			key := old[i].Namespace + "/" + claimName
+			ans.claimUsers[key] = slices.DeleteFunc(slices.Clone(ans.claimUsers[key]), onNode)
+		}
+	}
+	for i := range pods {
+		p := &pods[i]
+		for _, claimName := range podClaimNames(p) {
+			key := p.Namespace + "/" + claimName
+			ans.claimUsers[key] = append(slices.Clip(ans.claimUsers[key]), p)
+		}
+	}
+
+	node, ok := s.name2node[nodeName]
+	if !ok {
+		return &ans
+	}
+	if len(s.spreadConstraints) > 0 && nodeHasSpreadTopologyKeys(node, s.spreadConstraints) {
+		ans.spreadConstraints = slices.Clone(s.spreadConstraints)
+		for i := range ans.spreadConstraints {
+			c := &ans.spreadConstraints[i]
+			if !spreadIncludesNode(pod, s.runtimeClass, node, &c.raw) {
+				continue
+			}
+			c.counts = maps.Clone(c.counts)
+			c.counts[node.Labels[c.raw.TopologyKey]] += countPodsMatchSelector(pods, c.selector, pod.Namespace) -
+				countPodsMatchSelector(old, c.selector, pod.Namespace)
+			c.updateMinMatch()
+		}
+	}
+
+	ans.existingAntiAffinity = maps.Clone(s.existingAntiAffinity)
+	// node 上 pod 的 term 只会落在 node 自身 label 对应的拓扑域
+	for k, v := range node.Labels {
+		pair := topologyPair{key: k, value: v}
+		if ms, ok := ans.existingAntiAffinity[pair]; ok {
+			ans.existingAntiAffinity[pair] = slices.DeleteFunc(slices.Clone(ms), func(m DetailExistingPodAntiAffinity) bool {
+				return m.PodNodeName == nodeName
+			})
+		}
+	}
+	for _, m := range existingAntiAffinity(pod, s, node, pods) {
+		pair := topologyPair{key: m.Term.TopologyKey, value: m.TopologyValue}
+		ans.existingAntiAffinity[pair] = append(slices.Clip(ans.existingAntiAffinity[pair]), m)
+	}
+	return &ans
+}
+
+// domainNodes 返回 label topologyKey=value 的所有 node
+func (s *snapshot) domainNodes(topologyKey, value string) []*v1.Node {
+	value2nodes, ok := s.domains[topologyKey]
+	if !ok {
+		value2nodes = map[string][]*v1.Node{}
+		for i := range s.nodes {
+			node := &s.nodes[i]
+			if v, ok := node.Labels[topologyKey]; ok {
+				value2nodes[v] = append(value2nodes[v], node)
+			}
+		}
+		s.domains[topologyKey] = value2nodes
+	}
+	return value2nodes[value]
+}
+
+// domainPods 返回拓扑域 topologyKey=value 内所有 node 上的 pod
+func (s *snapshot) domainPods(topologyKey, value string) []v1.Pod {
+	var ans []v1.Pod
+	for _, node := range s.domainNodes(topologyKey, value) {
+		ans = append(ans, s.node2pods[node.Name]...)
+	}
+	return ans
+}
+
+// topologyPods 返回带有 label topologyKey 的所有 node 上的 pod
+func (s *snapshot) topologyPods(topologyKey string) []v1.Pod {
+	var ans []v1.Pod
+	for i := range s.nodes {
+		node := &s.nodes[i]
+		if _, ok := node.Labels[topologyKey]; ok {
+			ans = append(ans, s.node2pods[node.Name]...)
+		}
+	}
+	return ans
+}
+
+// termMatchesNamespace 与上游一致：namespaces 与 namespaceSelector 任一命中即可，
+// 二者均为空时默认为 matchingNamespace，即定义该 term 的 pod 所在的 namespace
+func (s *snapshot) termMatchesNamespace(matchingNamespace, namespace string, term *v1.PodAffinityTerm) bool {
+	if len(term.Namespaces) == 0 && term.NamespaceSelector == nil {
+		return namespace == matchingNamespace
+	}
+	if slices.Contains(term.Namespaces, namespace) {
+		return true
+	}
+	if term.NamespaceSelector == nil {
+		return false
+	}
+	// 空 selector {} 匹配所有 namespace
+	sel, err := metav1.LabelSelectorAsSelector(term.NamespaceSelector)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(s.ns2labels[namespace])
+}
+
+// termNamespaces 返回 term 解析出的所有 namespace
+func (s *snapshot) termNamespaces(matchingNamespace string, term *v1.PodAffinityTerm) []string {
+	var ans []string
+	if len(term.Namespaces) == 0 && term.NamespaceSelector == nil {
+		return []string{matchingNamespace}
+	}
+	ans = append(ans, term.Namespaces...)
+	if term.NamespaceSelector != nil {
+		for ns := range s.ns2labels {
+			if s.termMatchesNamespace(matchingNamespace, ns, term) {
+				ans = append(ans, ns)
+			}
+		}
+	}
+	slices.Sort(ans)
+	return slices.Compact(ans)
+}
@@ -0,0 +1,171 @@
+package ypd
+
+import (
+	"math"
+
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// spreadConstraint 是一条 whenUnsatisfiable=DoNotSchedule 的拓扑分布约束，以及它在集群中的计数
+type spreadConstraint struct {
+	raw      v1.TopologySpreadConstraint
+	selector labels.Selector
+	// 拓扑域 -> 匹配 selector 的 pod 数
+	counts   map[string]int
+	minMatch int
+}
+
+// newSpreadConstraints 与上游 PodTopologySpread 的 PreFilter 保持一致
+func newSpreadConstraints(pod *v1.Pod, snap *snapshot) ([]spreadConstraint, []DetailWarning) {
+	var (
+		constraints []spreadConstraint
+		warnings    []DetailWarning
+	)
+	for _, c := range pod.Spec.TopologySpreadConstraints {
+		if c.WhenUnsatisfiable != v1.DoNotSchedule {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(c.LabelSelector)
+		if err != nil {
+			warnings = append(warnings, newWarning(ReasonTopologySpreadMismatch, "invalid labelSelector of topology spread constraint %s: %v", c.TopologyKey, err))
+			continue
+		}
+		// matchLabelKeys 取待调度 pod 上对应 label 的值，合并进 selector
+		for _, key := range c.MatchLabelKeys {
+			value, ok := pod.Labels[key]
+			if !ok {
+				continue
+			}
+			r, err := labels.NewRequirement(key, selection.Equals, []string{value})
+			if err != nil {
+				warnings = append(warnings, newWarning(ReasonTopologySpreadMismatch, "invalid matchLabelKeys of topology spread constraint %s: %v", c.TopologyKey, err))
+				continue
+			}
+			selector = selector.Add(*r)
+		}
+		constraints = append(constraints, spreadConstraint{
+			raw:      c,
+			selector: selector,
+			counts:   map[string]int{},
+		})
+	}
+	if len(constraints) == 0 {
+		return nil, warnings
+	}
+
+	for i := range snap.nodes {
+		node := &snap.nodes[i]
+		// node 需带有所有约束的 topologyKey 才参与计数
+		if !nodeHasSpreadTopologyKeys(node, constraints) {
+			continue
+		}
+		for j := range constraints {
+			c := &constraints[j]
+			if !spreadIncludesNode(pod, snap.runtimeClass, node, &c.raw) {
+				continue
+			}
+			value := node.Labels[c.raw.TopologyKey]
+			c.counts[value] += countPodsMatchSelector(snap.node2pods[node.Name], c.selector, pod.Namespace)
+		}
+	}
+
+	for j := range constraints {
+		constraints[j].updateMinMatch()
+	}
+	return constraints, warnings
+}
+
+// updateMinMatch 根据各拓扑域计数计算全局最小值
+func (c *spreadConstraint) updateMinMatch() {
+	minDomains := 1
+	if c.raw.MinDomains != nil {
+		minDomains = int(*c.raw.MinDomains)
+	}
+	// 拓扑域数量不足 minDomains 时，全局最小值视为 0
+	if len(c.counts) < minDomains {
+		c.minMatch = 0
+		return
+	}
+	c.minMatch = math.MaxInt
+	for _, n := range c.counts {
+		c.minMatch = min(c.minMatch, n)
+	}
+}
+
+func nodeHasSpreadTopologyKeys(node *v1.Node, constraints []spreadConstraint) bool {
+	for _, c := range constraints {
+		if _, ok := node.Labels[c.raw.TopologyKey]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// spreadIncludesNode 实现 nodeAffinityPolicy（默认 Honor）和 nodeTaintsPolicy（默认 Ignore）
+func spreadIncludesNode(pod *v1.Pod, rc *nodev1.RuntimeClass, node *v1.Node, c *v1.TopologySpreadConstraint) bool {
+	if c.NodeAffinityPolicy == nil || *c.NodeAffinityPolicy == v1.NodeInclusionPolicyHonor {
+		if mismatches, _ := whyNodeAffinity(pod, rc, node); len(mismatches) > 0 {
+			return false
+		}
+	}
+	if c.NodeTaintsPolicy != nil && *c.NodeTaintsPolicy == v1.NodeInclusionPolicyHonor {
+		for _, taint := range node.Spec.Taints {
+			if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+				continue
+			}
+			if !toleratesTaint(podTolerations(pod, rc), taint) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func countPodsMatchSelector(pods []v1.Pod, selector labels.Selector, namespace string) int {
+	count := 0
+	for i := range pods {
+		p := &pods[i]
+		// 正在删除的 pod 不计数
+		if isTerminatingPod(p) || p.Namespace != namespace {
+			continue
+		}
+		if selector.Matches(labels.Set(p.Labels)) {
+			count++
+		}
+	}
+	return count
+}
+
+func whyTopologySpread(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailTopologySpreadMismatch {
+	var mismatches []DetailTopologySpreadMismatch
+	for _, c := range snap.spreadConstraints {
+		value, ok := node.Labels[c.raw.TopologyKey]
+		if !ok {
+			mismatches = append(mismatches, DetailTopologySpreadMismatch{
+				Constraint:         c.raw,
+				MissingTopologyKey: true,
+				DomainCounts:       c.counts,
+			})
+			continue
+		}
+		selfMatch := 0
+		if c.selector.Matches(labels.Set(pod.Labels)) {
+			selfMatch = 1
+		}
+		skew := c.counts[value] + selfMatch - c.minMatch
+		if skew > int(c.raw.MaxSkew) {
+			mismatches = append(mismatches, DetailTopologySpreadMismatch{
+				Constraint:    c.raw,
+				TopologyValue: value,
+				Skew:          skew,
+				MinMatch:      c.minMatch,
+				DomainCounts:  c.counts,
+			})
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,251 @@
+package ypd
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// noProvisioner 表示 StorageClass 不支持动态创建 pv，只能静态绑定
+const noProvisioner = "kubernetes.io/no-provisioner"
+
+// WhyStorage 诊断 pod 使用的每个未绑定或异常的 pvc
+func WhyStorage(pod *v1.Pod, cluster *Cluster) []DetailPvc {
+	if pod == nil || cluster == nil {
+		return nil
+	}
+	return whyStorage(pod, newSnapshot(pod, cluster))
+}
+
+// whyStorage 检查 pod 的 pvc，Blocking 的 pvc 使 pod 在所有 node 上都无法调度
+func whyStorage(pod *v1.Pod, snap *snapshot) []DetailPvc {
+	var ans []DetailPvc
+	for _, claimName := range podClaimNames(pod) {
+		pvc, ok := snap.name2pvc[pod.Namespace+"/"+claimName]
+		if !ok {
+			ans = append(ans, DetailPvc{
+				ClaimName: claimName,
+				Status:    PvcStatusMissing,
+				Message:   "persistentvolumeclaim not found",
+				Blocking:  true,
+			})
+			continue
+		}
+		d := DetailPvc{
+			ClaimName:        claimName,
+			StorageClassName: pvcClassName(pvc),
+			Events:           objectEvents(snap.cluster.Events, "PersistentVolumeClaim", pvc.Namespace, pvc.Name),
+		}
+		switch {
+		case pvc.DeletionTimestamp != nil:
+			d.Status, d.Blocking = PvcStatusTerminating, true
+			d.Message = "persistentvolumeclaim is being deleted"
+		case pvc.Status.Phase == v1.ClaimLost:
+			d.Status, d.Blocking = PvcStatusLost, true
+			d.Message = fmt.Sprintf("bound pv %s is lost", pvc.Spec.VolumeName)
+		case len(pvc.Spec.VolumeName) > 0 && snap.name2pv[pvc.Spec.VolumeName] == nil:
+			// 与上游 VolumeBinding 一致，绑定到不存在的 pv 时无法调度
+			d.Status, d.Blocking = PvcStatusPvMissing, true
+			d.Message = fmt.Sprintf("bound pv %s not found", pvc.Spec.VolumeName)
+		case len(pvc.Spec.VolumeName) > 0:
+			// 已绑定，由 whyPvAffinity 检查
+			continue
+		default:
+			d.AvailablePVs = pvNames(snap.availablePVs(pvc))
+			if sc := snap.pvcStorageClass(pvc); sc != nil && isWaitForFirstConsumer(sc) {
+				// 由调度器按 node 绑定，在 whyVolumeBinding 中逐 node 检查
+				d.Status = PvcStatusWaitForFirstConsumer
+				d.Message = fmt.Sprintf("waiting for first consumer, provisioner %s", sc.Provisioner)
+			} else {
+				d.Status, d.Blocking = PvcStatusPending, true
+				d.Message = "pod has unbound immediate persistentvolumeclaim"
+				if len(d.StorageClassName) > 0 && sc == nil {
+					d.Message += fmt.Sprintf(", storageclass %s not found", d.StorageClassName)
+				}
+			}
+		}
+		ans = append(ans, d)
+	}
+	return ans
+}
+
+// whyVolumeBinding 逐 node 检查 WaitForFirstConsumer 的 pvc 能否在 node 上绑定：
+// 先找能静态绑定且 node affinity 匹配的 pv，找不到时再看能否按 allowedTopologies 动态创建
+func whyVolumeBinding(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailVolumeBindingMismatch {
+	var mismatches []DetailVolumeBindingMismatch
+	for _, claimName := range podClaimNames(pod) {
+		pvc, ok := snap.name2pvc[pod.Namespace+"/"+claimName]
+		if !ok || len(pvc.Spec.VolumeName) > 0 || pvc.DeletionTimestamp != nil {
+			continue
+		}
+		sc := snap.pvcStorageClass(pvc)
+		if sc == nil || !isWaitForFirstConsumer(sc) {
+			continue
+		}
+		candidates := snap.availablePVs(pvc)
+		if slices.ContainsFunc(candidates, func(pv *v1.PersistentVolume) bool { return pvFitsNode(pv, node) }) {
+			continue
+		}
+		d := DetailVolumeBindingMismatch{
+			ClaimName:        claimName,
+			StorageClassName: sc.Name,
+			CandidatePVs:     pvNames(candidates),
+		}
+		if sc.Provisioner == noProvisioner {
+			d.Message = fmt.Sprintf("no available pv fits node among %d candidates", len(candidates))
+			mismatches = append(mismatches, d)
+			continue
+		}
+		if !allowedTopologiesMatch(sc.AllowedTopologies, node) {
+			d.Message = fmt.Sprintf("node is not in allowedTopologies of storageclass %s", sc.Name)
+			mismatches = append(mismatches, d)
+		}
+	}
+	return mismatches
+}
+
+func pvcClassName(pvc *v1.PersistentVolumeClaim) string {
+	if pvc.Spec.StorageClassName != nil {
+		return *pvc.Spec.StorageClassName
+	}
+	return ""
+}
+
+func (s *snapshot) pvcStorageClass(pvc *v1.PersistentVolumeClaim) *storagev1.StorageClass {
+	name := pvcClassName(pvc)
+	if len(name) == 0 {
+		return nil
+	}
+	return s.name2sc[name]
+}
+
+func isWaitForFirstConsumer(sc *storagev1.StorageClass) bool {
+	return sc.VolumeBindingMode != nil && *sc.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer
+}
+
+// availablePVs 返回可与 pvc 静态绑定的 pv：class、容量、访问模式、volumeMode、selector 和 claimRef 均匹配
+func (s *snapshot) availablePVs(pvc *v1.PersistentVolumeClaim) []*v1.PersistentVolume {
+	var (
+		ans       []*v1.PersistentVolume
+		className = pvcClassName(pvc)
+		request   = pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		selector  = labels.Everything()
+	)
+	if pvc.Spec.Selector != nil {
+		sel, err := metav1.LabelSelectorAsSelector(pvc.Spec.Selector)
+		if err != nil {
+			return nil
+		}
+		selector = sel
+	}
+	for _, pv := range s.name2pv {
+		if pv.DeletionTimestamp != nil || pv.Status.Phase != v1.VolumeAvailable {
+			continue
+		}
+		if ref := pv.Spec.ClaimRef; ref != nil && (ref.Namespace != pvc.Namespace || ref.Name != pvc.Name) {
+			continue
+		}
+		if pv.Spec.StorageClassName != className {
+			continue
+		}
+		capacity := pv.Spec.Capacity[v1.ResourceStorage]
+		if capacity.Cmp(request) < 0 {
+			continue
+		}
+		if !containsAccessModes(pv.Spec.AccessModes, pvc.Spec.AccessModes) {
+			continue
+		}
+		if volumeMode(pv.Spec.VolumeMode) != volumeMode(pvc.Spec.VolumeMode) {
+			continue
+		}
+		if !selector.Matches(labels.Set(pv.Labels)) {
+			continue
+		}
+		ans = append(ans, pv)
+	}
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name < ans[j].Name })
+	return ans
+}
+
+func containsAccessModes(modes, wanted []v1.PersistentVolumeAccessMode) bool {
+	for _, m := range wanted {
+		if !slices.Contains(modes, m) {
+			return false
+		}
+	}
+	return true
+}
+
+func volumeMode(mode *v1.PersistentVolumeMode) v1.PersistentVolumeMode {
+	if mode == nil {
+		return v1.PersistentVolumeFilesystem
+	}
+	return *mode
+}
+
+func pvFitsNode(pv *v1.PersistentVolume, node *v1.Node) bool {
+	na := pv.Spec.NodeAffinity
+	if na == nil || na.Required == nil {
+		return true
+	}
+	matched, _, _ := nodeSelectorTermsMatch(node, na.Required.NodeSelectorTerms)
+	return matched
+}
+
+// allowedTopologiesMatch terms 之间是 OR 关系，term 内的条件需全部满足，为空时匹配所有 node
+func allowedTopologiesMatch(terms []v1.TopologySelectorTerm, node *v1.Node) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	for _, term := range terms {
+		matched := true
+		for _, expr := range term.MatchLabelExpressions {
+			value, ok := node.Labels[expr.Key]
+			if !ok || !slices.Contains(expr.Values, value) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func pvNames(pvs []*v1.PersistentVolume) []string {
+	var ans []string
+	for _, pv := range pvs {
+		ans = append(ans, pv.Name)
+	}
+	return ans
+}
+
+// objectEvents 返回与指定对象相关的 event，按时间排序
+func objectEvents(events []v1.Event, kind, namespace, name string) []DetailEvent {
+	var ans []DetailEvent
+	for _, e := range events {
+		obj := e.InvolvedObject
+		if obj.Kind != kind || obj.Namespace != namespace || obj.Name != name {
+			continue
+		}
+		d := DetailEvent{
+			Type:          e.Type,
+			Reason:        e.Reason,
+			Message:       e.Message,
+			Count:         e.Count,
+			LastTimestamp: e.LastTimestamp,
+		}
+		if d.LastTimestamp.IsZero() {
+			d.LastTimestamp = metav1.NewTime(e.EventTime.Time)
+		}
+		ans = append(ans, d)
+	}
+	sort.SliceStable(ans, func(i, j int) bool { return ans[i].LastTimestamp.Before(&ans[j].LastTimestamp) })
+	return ans
+}
@@ -1,54 +1,127 @@
 package ypd
 
 import (
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Cluster 是分析 pod 所需的集群对象
+type Cluster struct {
+	Pods       []corev1.Pod
+	Nodes      []corev1.Node
+	PVCs       []corev1.PersistentVolumeClaim
+	PVs        []corev1.PersistentVolume
+	Namespaces []corev1.Namespace
+	// StorageClass 和 CSINode 用于计算 CSI volume 挂载上限
+	StorageClasses []storagev1.StorageClass
+	CSINodes       []storagev1.CSINode
+	// 用于判断 ReadWriteOnce 的 volume 是否仍挂载在其他 node 上
+	VolumeAttachments []storagev1.VolumeAttachment
+	// 用于模拟抢占
+	PriorityClasses []schedulingv1.PriorityClass
+	PDBs            []policyv1.PodDisruptionBudget
+	// pod 的 RuntimeClass 可能带有 nodeSelector 和 toleration
+	RuntimeClasses []nodev1.RuntimeClass
+	// 用于检查 pod 的 ResourceClaim 能否分配到 device，ResourceClaims 包含所有 namespace 的 claim
+	ResourceClaims         []resourcev1beta1.ResourceClaim
+	ResourceClaimTemplates []resourcev1beta1.ResourceClaimTemplate
+	DeviceClasses          []resourcev1beta1.DeviceClass
+	ResourceSlices         []resourcev1beta1.ResourceSlice
+	// pod 所在 namespace 的 event
+	Events []corev1.Event
+	// kube-node-lease 下的 node lease
+	Leases []coordinationv1.Lease
+	// kube-system 下的 lease，用于判断调度器是否在运行
+	SchedulerLeases []coordinationv1.Lease
+	// 判断 lease 是否过期的当前时间，为空时使用 time.Now()
+	Now time.Time
+}
+
 type Reason string
 
 const (
-	ReasonResourceNotEnough       Reason = "ResourceNotEnough"
-	ReasonNodeTaintNotTolerated   Reason = "NodeTaintNotTolerated"
-	ReasonNodeAffinityMismatch    Reason = "NodeAffinityMismatch"
-	ReasonPodAffinityMismatch     Reason = "PodAffinityMismatch"
-	ReasonPodAntiAffinityMismatch Reason = "PodAntiAffinityMismatch"
-	ReasonPvAffinityMismatch      Reason = "PvAffinityMismatch"
-	ReasonSchedulable             Reason = "Schedulable"
+	ReasonResourceNotEnough         Reason = "ResourceNotEnough"
+	ReasonNodeTaintNotTolerated     Reason = "NodeTaintNotTolerated"
+	ReasonNodeAffinityMismatch      Reason = "NodeAffinityMismatch"
+	ReasonPodAffinityMismatch       Reason = "PodAffinityMismatch"
+	ReasonPodAntiAffinityMismatch   Reason = "PodAntiAffinityMismatch"
+	ReasonExistingPodAntiAffinity   Reason = "ExistingPodAntiAffinity"
+	ReasonTopologySpreadMismatch    Reason = "TopologySpreadMismatch"
+	ReasonNodeUnhealthy             Reason = "NodeUnhealthy"
+	ReasonHostPortConflict          Reason = "HostPortConflict"
+	ReasonVolumeLimitExceeded       Reason = "VolumeLimitExceeded"
+	ReasonVolumeBindingMismatch     Reason = "VolumeBindingMismatch"
+	ReasonVolumeConflict            Reason = "VolumeConflict"
+	ReasonPvAffinityMismatch        Reason = "PvAffinityMismatch"
+	ReasonResourceClaimNotSatisfied Reason = "ResourceClaimNotSatisfied"
+	ReasonSchedulingGated           Reason = "SchedulingGated"
+	ReasonSchedulerNotRunning       Reason = "SchedulerNotRunning"
+	ReasonRuntimeClassNotFound      Reason = "RuntimeClassNotFound"
+	ReasonNodeNotFound              Reason = "NodeNotFound"
+	ReasonListForbidden             Reason = "ListForbidden"
+	ReasonListNotFound              Reason = "ListNotFound"
+	ReasonSchedulable               Reason = "Schedulable"
 )
 
+// PodDetail 是与 node 无关的 pod 级别分析结果
+type PodDetail struct {
+	// 存在 blocker 时 pod 不会进入调度，node 级别的结果仅供参考
+	Blockers []DetailPodBlocker `json:"blockers,omitempty"`
+	// 无法确定是否阻止调度的问题
+	Warnings []DetailWarning `json:"warnings,omitempty"`
+	Claims   []DetailPvc     `json:"claims,omitempty"`
+}
+
+type DetailPodBlocker struct {
+	Reason  Reason `json:"reason"`
+	Message string `json:"message"`
+}
+
 type Detail struct {
-	NodeName                string                          `json:"nodeName,omitempty"`
-	Schedulable             bool                            `json:"schedulable"`
-	ResourceNotEnough       []DetailResourceNotEnough       `json:"resourceNotEnough,omitempty"`
-	NodeTaintNotTolerated   []DetailTaintNotTolerated       `json:"nodeTaintNotTolerated,omitempty"`
-	NodeAffinityMismatch    []DetailNodeAffinityMismatch    `json:"nodeAffinityMismatch,omitempty"`
-	PodAffinityMismatch     []DetailPodAffinityMismatch     `json:"podAffinityMismatch,omitempty"`
-	PodAntiAffinityMismatch []DetailPodAntiAffinityMismatch `json:"podAntiAffinityMismatch,omitempty"`
-	PvAffinityMismatch      []DetailPvAffinityMismatch      `json:"pvAffinityMismatch,omitempty"`
+	NodeName    string `json:"nodeName,omitempty"`
+	Schedulable bool   `json:"schedulable"`
+	// 以下字段是 addFinding 按类型整理的内置 Checker 结果，json 中只保留 Findings
+	ResourceNotEnough         []DetailResourceNotEnough         `json:"-"`
+	NodeTaintNotTolerated     []DetailTaintNotTolerated         `json:"-"`
+	SoftTaintNotTolerated     []DetailTaintNotTolerated         `json:"-"`
+	NodeAffinityMismatch      []DetailNodeAffinityMismatch      `json:"-"`
+	PodAffinityMismatch       []DetailPodAffinityMismatch       `json:"-"`
+	PodAntiAffinityMismatch   []DetailPodAntiAffinityMismatch   `json:"-"`
+	ExistingPodAntiAffinity   []DetailExistingPodAntiAffinity   `json:"-"`
+	TopologySpreadMismatch    []DetailTopologySpreadMismatch    `json:"-"`
+	PvAffinityMismatch        []DetailPvAffinityMismatch        `json:"-"`
+	NodeHealth                []DetailNodeHealth                `json:"-"`
+	HostPortConflict          []DetailHostPortConflict          `json:"-"`
+	VolumeLimitExceeded       []DetailVolumeLimitExceeded       `json:"-"`
+	VolumeBindingMismatch     []DetailVolumeBindingMismatch     `json:"-"`
+	VolumeConflict            []DetailVolumeConflict            `json:"-"`
+	ResourceClaimNotSatisfied []DetailResourceClaimNotSatisfied `json:"-"`
+	WillFreeSoon              []DetailWillFreeSoon              `json:"-"`
+	Warnings                  []DetailWarning                   `json:"-"`
+	// 所有 Checker 的检查结果
+	Findings []Finding `json:"findings,omitempty"`
+	// 正在删除的 pod 释放资源后，资源是否足够
+	ResourceEnoughAfterTermination bool `json:"resourceEnoughAfterTermination,omitempty"`
 }
 
 func (w *Detail) String() string {
 	args := []string{w.NodeName}
-	if len(w.ResourceNotEnough) > 0 {
-		args = append(args, string(ReasonResourceNotEnough))
-	}
-	if len(w.NodeTaintNotTolerated) > 0 {
-		args = append(args, string(ReasonNodeTaintNotTolerated))
-	}
-	if len(w.NodeAffinityMismatch) > 0 {
-		args = append(args, string(ReasonNodeAffinityMismatch))
-	}
-	if len(w.PodAffinityMismatch) > 0 {
-		args = append(args, string(ReasonPodAffinityMismatch))
-	}
-	if len(w.PodAntiAffinityMismatch) > 0 {
-		args = append(args, string(ReasonPodAntiAffinityMismatch))
-	}
-	if len(w.PvAffinityMismatch) > 0 {
-		args = append(args, string(ReasonPvAffinityMismatch))
+	for _, f := range w.Findings {
+		if f.Severity == SeverityBlocking && !slices.Contains(args[1:], string(f.Reason)) {
+			args = append(args, string(f.Reason))
+		}
 	}
 	if len(args) == 1 {
 		args = append(args, string(ReasonSchedulable))
@@ -56,10 +129,77 @@ func (w *Detail) String() string {
 	return strings.Join(args, " ")
 }
 
+// addFinding 记录 Finding，内置 Checker 的结果同时填入对应类型的字段
+func (w *Detail) addFinding(f Finding) {
+	w.Findings = append(w.Findings, f)
+	if f.Severity == SeverityBlocking {
+		w.Schedulable = false
+	}
+	switch d := f.Data.(type) {
+	case DetailResourceNotEnough:
+		w.ResourceNotEnough = append(w.ResourceNotEnough, d)
+	case DetailWillFreeSoon:
+		w.WillFreeSoon = append(w.WillFreeSoon, d)
+	case DetailTaintNotTolerated:
+		if f.Severity == SeverityBlocking {
+			w.NodeTaintNotTolerated = append(w.NodeTaintNotTolerated, d)
+		} else {
+			w.SoftTaintNotTolerated = append(w.SoftTaintNotTolerated, d)
+		}
+	case DetailNodeAffinityMismatch:
+		w.NodeAffinityMismatch = append(w.NodeAffinityMismatch, d)
+	case DetailPodAffinityMismatch:
+		w.PodAffinityMismatch = append(w.PodAffinityMismatch, d)
+	case DetailPodAntiAffinityMismatch:
+		w.PodAntiAffinityMismatch = append(w.PodAntiAffinityMismatch, d)
+	case DetailExistingPodAntiAffinity:
+		w.ExistingPodAntiAffinity = append(w.ExistingPodAntiAffinity, d)
+	case DetailTopologySpreadMismatch:
+		w.TopologySpreadMismatch = append(w.TopologySpreadMismatch, d)
+	case DetailPvAffinityMismatch:
+		w.PvAffinityMismatch = append(w.PvAffinityMismatch, d)
+	case DetailNodeHealth:
+		w.NodeHealth = append(w.NodeHealth, d)
+	case DetailHostPortConflict:
+		w.HostPortConflict = append(w.HostPortConflict, d)
+	case DetailVolumeLimitExceeded:
+		w.VolumeLimitExceeded = append(w.VolumeLimitExceeded, d)
+	case DetailVolumeBindingMismatch:
+		w.VolumeBindingMismatch = append(w.VolumeBindingMismatch, d)
+	case DetailVolumeConflict:
+		w.VolumeConflict = append(w.VolumeConflict, d)
+	case DetailResourceClaimNotSatisfied:
+		w.ResourceClaimNotSatisfied = append(w.ResourceClaimNotSatisfied, d)
+	default:
+		if f.Severity == SeverityWarning {
+			w.Warnings = append(w.Warnings, DetailWarning{Reason: f.Reason, Message: f.Message})
+		}
+	}
+}
+
+// RequestPart 表示导致资源不足的是 pod 有效资源请求中的哪一部分
+type RequestPart string
+
+const (
+	RequestPartContainers     RequestPart = "containers"
+	RequestPartInitContainers RequestPart = "initContainers"
+	// pod.spec.resources 中的 pod 级别请求优先于容器请求之和
+	RequestPartPodLevel RequestPart = "podLevel"
+	// 去掉 sidecar 或 overhead 后剩余资源即可满足时，由它们导致资源不足
+	RequestPartSidecars RequestPart = "sidecars"
+	RequestPartOverhead RequestPart = "overhead"
+)
+
 type DetailResourceNotEnough struct {
-	ResourceName string            `json:"resourceName"`
-	Required     resource.Quantity `json:"required"`
-	Left         resource.Quantity `json:"left"`
+	ResourceName   string            `json:"resourceName"`
+	Required       resource.Quantity `json:"required"`
+	Left           resource.Quantity `json:"left"`
+	Containers     resource.Quantity `json:"containers"`
+	Sidecars       resource.Quantity `json:"sidecars"`
+	InitContainers resource.Quantity `json:"initContainers"`
+	Overhead       resource.Quantity `json:"overhead"`
+	PodLevel       resource.Quantity `json:"podLevel"`
+	Dominant       RequestPart       `json:"dominant"`
 }
 
 type DetailTaintNotTolerated struct {
@@ -67,20 +207,250 @@ type DetailTaintNotTolerated struct {
 }
 
 type DetailNodeAffinityMismatch struct {
-	Term corev1.NodeSelectorTerm `json:"term"`
+	Term      corev1.NodeSelectorTerm      `json:"term"`
+	Unmatched []DetailUnmatchedRequirement `json:"unmatched,omitempty"`
+	// 为 true 时 Term 由 pod.spec.nodeSelector 转换而来，否则来自 node affinity
+	NodeSelector bool `json:"nodeSelector,omitempty"`
+	// 非空时 Term 来自该 RuntimeClass 的 scheduling.nodeSelector
+	RuntimeClass string `json:"runtimeClass,omitempty"`
+	// 为 true 时 Term 来自调度器配置的 NodeAffinityArgs.addedAffinity
+	AddedAffinity bool `json:"addedAffinity,omitempty"`
+}
+
+// DetailUnmatchedRequirement 是 term 中不满足的一个条件，以及 node 上的实际值
+type DetailUnmatchedRequirement struct {
+	Requirement corev1.NodeSelectorRequirement `json:"requirement"`
+	// 为 true 时 Requirement 来自 MatchFields，否则来自 MatchExpressions
+	Field      bool   `json:"field,omitempty"`
+	NodeHasKey bool   `json:"nodeHasKey"`
+	NodeValue  string `json:"nodeValue,omitempty"`
 }
 
 type DetailPodAffinityMismatch struct {
 	Term corev1.PodAffinityTerm `json:"term"`
+	// 合并 matchLabelKeys 和 mismatchLabelKeys 后实际生效的 selector
+	Selector string `json:"selector"`
+	// term 解析出的 namespace
+	Namespaces []string `json:"namespaces"`
+	// node 所在拓扑域，即 node 上 label term.topologyKey 的值
+	TopologyValue string `json:"topologyValue,omitempty"`
+	// node 没有 label term.topologyKey
+	MissingTopologyKey bool `json:"missingTopologyKey,omitempty"`
 }
 
 type DetailPodAntiAffinityMismatch struct {
-	Term      corev1.PodAffinityTerm `json:"term"`
-	Namespace string                 `json:"namespace"`
-	PodName   string                 `json:"podName"`
+	Term          corev1.PodAffinityTerm `json:"term"`
+	Namespace     string                 `json:"namespace"`
+	PodName       string                 `json:"podName"`
+	PodNodeName   string                 `json:"podNodeName"`
+	TopologyValue string                 `json:"topologyValue"`
+}
+
+// DetailExistingPodAntiAffinity 表示已有 pod 的 anti-affinity term 匹配了待调度的 pod
+type DetailExistingPodAntiAffinity struct {
+	Term          corev1.PodAffinityTerm `json:"term"`
+	Selector      string                 `json:"selector"`
+	Namespace     string                 `json:"namespace"`
+	PodName       string                 `json:"podName"`
+	PodNodeName   string                 `json:"podNodeName"`
+	TopologyValue string                 `json:"topologyValue"`
+}
+
+// DetailTopologySpreadMismatch 表示 pod 调度到 node 后拓扑分布的 skew 超过 maxSkew，
+// 或 node 没有约束要求的 topologyKey
+type DetailTopologySpreadMismatch struct {
+	Constraint         corev1.TopologySpreadConstraint `json:"constraint"`
+	TopologyValue      string                          `json:"topologyValue,omitempty"`
+	MissingTopologyKey bool                            `json:"missingTopologyKey,omitempty"`
+	Skew               int                             `json:"skew"`
+	MinMatch           int                             `json:"minMatch"`
+	// 各拓扑域中匹配 labelSelector 的 pod 数
+	DomainCounts map[string]int `json:"domainCounts"`
 }
 
 type DetailPvAffinityMismatch struct {
-	Term   corev1.NodeSelectorTerm `json:"term"`
-	PvName string                  `json:"pvName"`
+	Term      corev1.NodeSelectorTerm      `json:"term"`
+	PvName    string                       `json:"pvName"`
+	Unmatched []DetailUnmatchedRequirement `json:"unmatched,omitempty"`
+}
+
+type DetailWillFreeSoon struct {
+	Namespace         string              `json:"namespace"`
+	PodName           string              `json:"podName"`
+	DeletionTimestamp metav1.Time         `json:"deletionTimestamp"`
+	Resources         corev1.ResourceList `json:"resources"`
+}
+
+// DetailWarning 表示某项检查无法得出准确结论，例如遇到非法或暂不支持的配置
+type DetailWarning struct {
+	Reason  Reason `json:"reason"`
+	Message string `json:"message"`
+}
+
+func newWarning(reason Reason, format string, args ...any) DetailWarning {
+	return DetailWarning{
+		Reason:  reason,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// DetailHostPortConflict 表示 pod 需要的 host port 已被 node 上的其他 pod 占用
+type DetailHostPortConflict struct {
+	Protocol  string `json:"protocol"`
+	HostIP    string `json:"hostIP"`
+	HostPort  int32  `json:"hostPort"`
+	Namespace string `json:"namespace"`
+	PodName   string `json:"podName"`
+	// 已有 pod 绑定的 hostIP
+	PodHostIP string `json:"podHostIP"`
+	// 已有 pod 是否使用 hostNetwork
+	PodHostNetwork bool `json:"podHostNetwork,omitempty"`
+}
+
+// DetailVolumeLimitExceeded 表示 node 上某个 CSI driver 已挂载的 volume 加上 pod 新需要的 volume 超过了 CSINode 上的上限
+type DetailVolumeLimitExceeded struct {
+	Driver   string `json:"driver"`
+	Limit    int32  `json:"limit"`
+	Attached int    `json:"attached"`
+	Required int    `json:"required"`
+}
+
+// DetailVolumeBindingMismatch 表示 WaitForFirstConsumer 的 pvc 无法在 node 上绑定
+type DetailVolumeBindingMismatch struct {
+	ClaimName        string `json:"claimName"`
+	StorageClassName string `json:"storageClassName"`
+	Message          string `json:"message"`
+	// class、容量、访问模式匹配，但 node affinity 不匹配该 node 的 pv
+	CandidatePVs []string `json:"candidatePVs,omitempty"`
+}
+
+// DetailVolumeConflict 表示 pod 的 pvc 已被其他 pod 独占，或 volume 仍挂载在其他 node 上
+type DetailVolumeConflict struct {
+	ClaimName  string                            `json:"claimName"`
+	PvName     string                            `json:"pvName,omitempty"`
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode"`
+	// 占用该 pvc 的 pod
+	Namespace string `json:"namespace,omitempty"`
+	PodName   string `json:"podName,omitempty"`
+	// 占用该 volume 的 node
+	NodeName       string `json:"nodeName"`
+	AttachmentName string `json:"attachmentName,omitempty"`
+	Message        string `json:"message"`
+}
+
+// DetailResourceClaimNotSatisfied 表示 ResourceClaim 的某个 request 无法在 node 上分配到 device
+type DetailResourceClaimNotSatisfied struct {
+	Claim string `json:"claim"`
+	// claim 本身无法使用时为空
+	Request     string `json:"request,omitempty"`
+	DeviceClass string `json:"deviceClass,omitempty"`
+	// 需要的、满足 selector 的、以及其中未被分配的 device 数量
+	Required  int    `json:"required,omitempty"`
+	Matched   int    `json:"matched,omitempty"`
+	Available int    `json:"available,omitempty"`
+	Message   string `json:"message"`
+}
+
+// DetailPreemption 是抢占模拟的结果
+type DetailPreemption struct {
+	Priority          int32                       `json:"priority"`
+	PreemptionPolicy  corev1.PreemptionPolicy     `json:"preemptionPolicy"`
+	Message           string                      `json:"message,omitempty"`
+	NominatedNodeName string                      `json:"nominatedNodeName,omitempty"`
+	Candidates        []DetailPreemptionCandidate `json:"candidates,omitempty"`
+}
+
+// DetailPreemptionCandidate 是驱逐 Victims 后 pod 即可调度的 node
+type DetailPreemptionCandidate struct {
+	NodeName      string         `json:"nodeName"`
+	Victims       []DetailVictim `json:"victims"`
+	PDBViolations int            `json:"pdbViolations"`
+}
+
+type DetailVictim struct {
+	Namespace string `json:"namespace"`
+	PodName   string `json:"podName"`
+	Priority  int32  `json:"priority"`
+	// 驱逐该 pod 会违反的 PDB
+	ViolatesPDB []string `json:"violatesPDB,omitempty"`
+}
+
+// DetailSchedulingEvent 对照调度器最近一次 FailedScheduling event 中各原因的 node 数与 ypd 的结论
+type DetailSchedulingEvent struct {
+	Event DetailEvent `json:"event"`
+	// event 中 "0/N nodes are available" 的 N
+	Nodes int `json:"nodes"`
+	// ypd 分析的 node 数，以及其中可以调度的 node 数
+	YpdNodes            int                 `json:"ypdNodes"`
+	YpdSchedulableNodes int                 `json:"ypdSchedulableNodes"`
+	Reasons             []DetailEventReason `json:"reasons,omitempty"`
+	// 不一致之处，通常说明 ypd 遗漏了某个约束，或者集群在 event 之后发生了变化
+	Disagreements []string `json:"disagreements,omitempty"`
+}
+
+// DetailEventReason 是 event 中的一个原因，以及 ypd 得出相同原因的 node 数。
+// 调度器在第一个失败的插件处停止，所以 ypd 的 node 数多于 event 是正常的，少于 event 时 Disagree 为 true
+type DetailEventReason struct {
+	// event 中的原文，ypd 独有的原因为空
+	Message string `json:"message,omitempty"`
+	// 对应的 ypd Reason，无法对应时为空
+	Reason Reason `json:"reason,omitempty"`
+	// Reason 为 ResourceNotEnough 时是资源名，为 NodeTaintNotTolerated 时是 taint 的 key
+	Key        string `json:"key,omitempty"`
+	EventNodes int    `json:"eventNodes"`
+	YpdNodes   int    `json:"ypdNodes"`
+	Disagree   bool   `json:"disagree,omitempty"`
+}
+
+type PvcStatus string
+
+const (
+	PvcStatusMissing              PvcStatus = "Missing"
+	PvcStatusPending              PvcStatus = "Pending"
+	PvcStatusWaitForFirstConsumer PvcStatus = "WaitForFirstConsumer"
+	PvcStatusLost                 PvcStatus = "Lost"
+	PvcStatusTerminating          PvcStatus = "Terminating"
+	// pvc 已绑定的 pv 不存在
+	PvcStatusPvMissing PvcStatus = "PvMissing"
+)
+
+// DetailPvc 是 pod 使用的一个未绑定或异常 pvc 的诊断结果
+type DetailPvc struct {
+	ClaimName        string    `json:"claimName"`
+	Status           PvcStatus `json:"status"`
+	StorageClassName string    `json:"storageClassName,omitempty"`
+	Message          string    `json:"message"`
+	// 为 true 时 pod 在所有 node 上都无法调度
+	Blocking bool `json:"blocking"`
+	// 可静态绑定的 pv
+	AvailablePVs []string      `json:"availablePVs,omitempty"`
+	Events       []DetailEvent `json:"events,omitempty"`
+}
+
+type DetailEvent struct {
+	Type          string      `json:"type"`
+	Reason        string      `json:"reason"`
+	Message       string      `json:"message"`
+	Count         int32       `json:"count"`
+	LastTimestamp metav1.Time `json:"lastTimestamp"`
+}
+
+type NodeHealthType string
+
+const (
+	NodeHealthCordoned           NodeHealthType = "Cordoned"
+	NodeHealthNotReady           NodeHealthType = "NotReady"
+	NodeHealthNetworkUnavailable NodeHealthType = "NetworkUnavailable"
+	NodeHealthMemoryPressure     NodeHealthType = "MemoryPressure"
+	NodeHealthDiskPressure       NodeHealthType = "DiskPressure"
+	NodeHealthPIDPressure        NodeHealthType = "PIDPressure"
+	NodeHealthStaleLease         NodeHealthType = "StaleLease"
+)
+
+type DetailNodeHealth struct {
+	Type               NodeHealthType `json:"type"`
+	Message            string         `json:"message"`
+	LastTransitionTime metav1.Time    `json:"lastTransitionTime"`
+	// node 带有对应的 taint 且 pod 不能容忍时阻止调度
+	Blocking bool `json:"blocking"`
 }
@@ -0,0 +1,34 @@
+package ypd
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// podClaimNames 返回 pod 使用的所有 pvc 名，包括 generic ephemeral volume 自动创建的 pvc
+func podClaimNames(pod *v1.Pod) []string {
+	var ans []string
+	for _, v := range pod.Spec.Volumes {
+		switch {
+		case v.PersistentVolumeClaim != nil:
+			ans = append(ans, v.PersistentVolumeClaim.ClaimName)
+		case v.Ephemeral != nil:
+			ans = append(ans, pod.Name+"-"+v.Name)
+		}
+	}
+	return ans
+}
+
+// podPVs 返回 pod 的 pvc 已绑定的 pv
+func podPVs(pod *v1.Pod, snap *snapshot) []v1.PersistentVolume {
+	var ans []v1.PersistentVolume
+	for _, claimName := range podClaimNames(pod) {
+		pvc, ok := snap.name2pvc[pod.Namespace+"/"+claimName]
+		if !ok || len(pvc.Spec.VolumeName) == 0 {
+			continue
+		}
+		if pv, ok := snap.name2pv[pvc.Spec.VolumeName]; ok {
+			ans = append(ans, *pv)
+		}
+	}
+	return ans
+}
@@ -0,0 +1,80 @@
+package ypd
+
+import (
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// whyVolumeConflict 检查 pod 的 pvc 是否已被其他 pod 或其他 node 独占：
+// ReadWriteOncePod 的 pvc 只能被一个 pod 使用；ReadWriteOnce 的 volume 只能挂载到一个 node
+func whyVolumeConflict(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailVolumeConflict {
+	var conflicts []DetailVolumeConflict
+	for _, claimName := range podClaimNames(pod) {
+		key := pod.Namespace + "/" + claimName
+		pvc, ok := snap.name2pvc[key]
+		if !ok {
+			continue
+		}
+		modes := pvc.Spec.AccessModes
+		pv, bound := snap.name2pv[pvc.Spec.VolumeName]
+		if bound {
+			modes = pv.Spec.AccessModes
+		}
+
+		// 1. ReadWriteOncePod：任何其他 pod 在使用都会冲突，与所在 node 无关
+		if slices.Contains(pvc.Spec.AccessModes, v1.ReadWriteOncePod) {
+			for _, user := range snap.claimUsers[key] {
+				conflicts = append(conflicts, DetailVolumeConflict{
+					ClaimName:  claimName,
+					AccessMode: v1.ReadWriteOncePod,
+					Namespace:  user.Namespace,
+					PodName:    user.Name,
+					NodeName:   user.Spec.NodeName,
+					Message:    "persistentvolumeclaim with ReadWriteOncePod access mode is in use by another pod",
+				})
+			}
+			continue
+		}
+
+		// 2. ReadWriteOnce：只有 RWO 时 volume 不能同时挂载到其他 node
+		if !bound || !slices.Equal(uniqueAccessModes(modes), []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}) {
+			continue
+		}
+		for _, user := range snap.claimUsers[key] {
+			if user.Spec.NodeName == node.Name {
+				continue
+			}
+			conflicts = append(conflicts, DetailVolumeConflict{
+				ClaimName:  claimName,
+				PvName:     pv.Name,
+				AccessMode: v1.ReadWriteOnce,
+				Namespace:  user.Namespace,
+				PodName:    user.Name,
+				NodeName:   user.Spec.NodeName,
+				Message:    fmt.Sprintf("ReadWriteOnce volume is used by a pod on node %s", user.Spec.NodeName),
+			})
+		}
+		for _, va := range snap.pv2attachments[pv.Name] {
+			if va.Spec.NodeName == node.Name || !va.Status.Attached {
+				continue
+			}
+			conflicts = append(conflicts, DetailVolumeConflict{
+				ClaimName:      claimName,
+				PvName:         pv.Name,
+				AccessMode:     v1.ReadWriteOnce,
+				NodeName:       va.Spec.NodeName,
+				AttachmentName: va.Name,
+				Message:        fmt.Sprintf("ReadWriteOnce volume is still attached to node %s", va.Spec.NodeName),
+			})
+		}
+	}
+	return conflicts
+}
+
+func uniqueAccessModes(modes []v1.PersistentVolumeAccessMode) []v1.PersistentVolumeAccessMode {
+	ans := slices.Clone(modes)
+	slices.Sort(ans)
+	return slices.Compact(ans)
+}
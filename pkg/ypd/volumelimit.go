@@ -0,0 +1,105 @@
+package ypd
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// csiVolume 以 driver 和 volume handle 唯一标识一个 CSI volume
+type csiVolume struct {
+	Driver string
+	Handle string
+}
+
+// podCSIVolumes 与上游 CSILimits 一致：已绑定的 pvc 取 pv 的 CSI driver 和 volumeHandle，
+// 未绑定的 pvc 取 StorageClass 的 provisioner，并以 pvc 名作为 volume handle
+func podCSIVolumes(pod *v1.Pod, snap *snapshot) []csiVolume {
+	var ans []csiVolume
+	for _, claimName := range podClaimNames(pod) {
+		pvc, ok := snap.name2pvc[pod.Namespace+"/"+claimName]
+		if !ok {
+			continue
+		}
+		if pvName := pvc.Spec.VolumeName; len(pvName) > 0 {
+			pv, ok := snap.name2pv[pvName]
+			if !ok || pv.Spec.CSI == nil {
+				continue
+			}
+			ans = append(ans, csiVolume{Driver: pv.Spec.CSI.Driver, Handle: pv.Spec.CSI.VolumeHandle})
+			continue
+		}
+		if pvc.Spec.StorageClassName == nil {
+			continue
+		}
+		sc, ok := snap.name2sc[*pvc.Spec.StorageClassName]
+		if !ok {
+			continue
+		}
+		ans = append(ans, csiVolume{Driver: sc.Provisioner, Handle: pvc.Namespace + "/" + pvc.Name})
+	}
+	return ans
+}
+
+func whyVolumeLimit(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailVolumeLimitExceeded {
+	csiNode, ok := snap.name2csinode[node.Name]
+	if !ok {
+		return nil
+	}
+	limits := map[string]int32{}
+	for _, d := range csiNode.Spec.Drivers {
+		if d.Allocatable != nil && d.Allocatable.Count != nil {
+			limits[d.Name] = *d.Allocatable.Count
+		}
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+
+	// 1. 统计 node 上已挂载的 volume
+	attached := map[csiVolume]struct{}{}
+	nodePods := snap.node2pods[node.Name]
+	for i := range nodePods {
+		for _, v := range podCSIVolumes(&nodePods[i], snap) {
+			attached[v] = struct{}{}
+		}
+	}
+
+	// 2. 统计 pod 需要新挂载的 volume
+	newVolumes := map[csiVolume]struct{}{}
+	for _, v := range podCSIVolumes(pod, snap) {
+		if _, ok := attached[v]; !ok {
+			newVolumes[v] = struct{}{}
+		}
+	}
+	if len(newVolumes) == 0 {
+		return nil
+	}
+
+	// 3. 按 driver 对比数量和上限
+	attachedCount := map[string]int{}
+	for v := range attached {
+		attachedCount[v.Driver]++
+	}
+	newCount := map[string]int{}
+	for v := range newVolumes {
+		newCount[v.Driver]++
+	}
+	var exceeded []DetailVolumeLimitExceeded
+	for driver, n := range newCount {
+		limit, ok := limits[driver]
+		if !ok {
+			continue
+		}
+		if attachedCount[driver]+n > int(limit) {
+			exceeded = append(exceeded, DetailVolumeLimitExceeded{
+				Driver:   driver,
+				Limit:    limit,
+				Attached: attachedCount[driver],
+				Required: n,
+			})
+		}
+	}
+	sort.Slice(exceeded, func(i, j int) bool { return exceeded[i].Driver < exceeded[j].Driver })
+	return exceeded
+}
@@ -1,82 +1,116 @@
 package ypd
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"sort"
 
 	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 )
 
-func WhyPending(pod *v1.Pod, pods []v1.Pod, nodes []v1.Node, pvs []v1.PersistentVolume) []Detail {
-	if pod == nil {
-		return nil
+func WhyPending(pod *v1.Pod, cluster *Cluster) []Detail {
+	ans, _ := WhyPendingWithOptions(pod, cluster, Options{})
+	return ans
+}
+
+// WhyPendingWithOptions 只运行 opts 选中的 Checker，opts 中有未注册的 Checker 时报错
+func WhyPendingWithOptions(pod *v1.Pod, cluster *Cluster, opts Options) ([]Detail, error) {
+	checkers, err := opts.checkers()
+	if err != nil {
+		return nil, err
 	}
-	if len(nodes) == 0 {
-		return nil
+	if pod == nil || cluster == nil {
+		return nil, nil
+	}
+	if len(cluster.Nodes) == 0 {
+		return nil, nil
 	}
 	var (
-		node2pods = map[string][]v1.Pod{}
-		ans       []Detail
+		snap = newSnapshot(pod, cluster)
+		ans  []Detail
 	)
-	for _, p := range pods {
-		if n := p.Spec.NodeName; len(n) > 0 {
-			node2pods[n] = append(node2pods[n], p)
+	snap.checkers = checkers
+	snap.opts = opts
+	for i := range snap.nodes {
+		ans = append(ans, whySingleNode(pod, snap, &snap.nodes[i]))
+	}
+	return ans, nil
+}
+
+func whySingleNode(pod *v1.Pod, snap *snapshot, node *v1.Node) Detail {
+	nodePods := snap.node2pods[node.Name]
+	in := &CheckInput{
+		Pod:      pod,
+		Node:     node,
+		NodePods: nodePods,
+		Cluster:  snap.cluster,
+		snap:     snap,
+	}
+	var findings []Finding
+	for _, c := range snap.checkers {
+		for _, f := range c.Check(in) {
+			f.Checker = c.Name()
+			findings = append(findings, f)
 		}
 	}
-	for i := range nodes {
-		node := &nodes[i]
-		nodePods := node2pods[node.Name]
-		ans = append(ans, whySingleNode(pod, nodePods, node, pvs))
+	ans := NewDetail(node.Name, findings)
+	if len(ans.ResourceNotEnough) > 0 && len(ans.WillFreeSoon) > 0 {
+		ans.ResourceEnoughAfterTermination = len(whyResource(pod, withoutTerminatingPods(nodePods), node, &snap.opts)) == 0
 	}
 	return ans
 }
 
-func whySingleNode(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node, pvs []v1.PersistentVolume) Detail {
-	ans := Detail{
-		NodeName:                node.Name,
-		ResourceNotEnough:       whyResource(pod, nodePods, node),
-		NodeAffinityMismatch:    whyNodeAffinity(pod, node),
-		NodeTaintNotTolerated:   whyNodeTaint(pod, node),
-		PodAffinityMismatch:     whyPodAffinity(pod, nodePods, node),
-		PodAntiAffinityMismatch: whyPodAntiAffinity(pod, nodePods, node),
-		PvAffinityMismatch:      whyPvAffinity(node, pvs),
-	}
-	if len(ans.ResourceNotEnough)+len(ans.NodeAffinityMismatch)+len(ans.NodeTaintNotTolerated)+
-		len(ans.PodAffinityMismatch)+len(ans.PodAntiAffinityMismatch) == 0 {
-		ans.Schedulable = true
+func isTerminalPod(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+func isTerminatingPod(pod *v1.Pod) bool {
+	return pod.DeletionTimestamp != nil
+}
+
+func withoutTerminatingPods(pods []v1.Pod) []v1.Pod {
+	var ans []v1.Pod
+	for i := range pods {
+		if !isTerminatingPod(&pods[i]) {
+			ans = append(ans, pods[i])
+		}
 	}
 	return ans
 }
 
-func whyResource(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node) []DetailResourceNotEnough {
-	// 1. 计算 pod 资源请求
-	podRequests := map[v1.ResourceName]resource.Quantity{}
-	for _, c := range pod.Spec.Containers {
-		for name, qty := range c.Resources.Requests {
-			if q, ok := podRequests[name]; ok {
-				q.Add(qty)
-				podRequests[name] = q
-			} else {
-				podRequests[name] = qty.DeepCopy()
-			}
+// whyWillFreeSoon 列出 node 上正在删除的 pod，它们仍占用资源，但删除完成后即会释放
+func whyWillFreeSoon(nodePods []v1.Pod) []DetailWillFreeSoon {
+	var ans []DetailWillFreeSoon
+	for i := range nodePods {
+		p := &nodePods[i]
+		if !isTerminatingPod(p) {
+			continue
 		}
+		ans = append(ans, DetailWillFreeSoon{
+			Namespace:         p.Namespace,
+			PodName:           p.Name,
+			DeletionTimestamp: *p.DeletionTimestamp,
+			Resources:         computePodRequests(p).Total,
+		})
 	}
+	return ans
+}
+
+// whyResource 对比 pod 请求与 node 剩余资源，跳过 opts 中忽略的扩展资源
+func whyResource(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node, opts *Options) []DetailResourceNotEnough {
+	// 1. 计算 pod 资源请求
+	podRequests := computePodRequests(pod)
 
 	// 2. 计算 node 已分配资源
-	used := map[v1.ResourceName]resource.Quantity{}
-	for _, p := range nodePods {
-		for _, c := range p.Spec.Containers {
-			for name, qty := range c.Resources.Requests {
-				if q, ok := used[name]; ok {
-					q.Add(qty)
-					used[name] = q
-				} else {
-					used[name] = qty.DeepCopy()
-				}
-			}
-		}
+	used := v1.ResourceList{}
+	for i := range nodePods {
+		addResourceList(used, computePodRequests(&nodePods[i]).Total)
 	}
 
 	// 3. 计算 node allocatable
@@ -96,176 +130,489 @@ func whyResource(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node) []DetailResource
 
 	// 5. 对比 pod 请求和剩余资源
 	var notEnough []DetailResourceNotEnough
-	for name, req := range podRequests {
+	for name, req := range podRequests.Total {
+		if opts.ignoresResource(name) {
+			continue
+		}
 		left, ok := remain[name]
 		if !ok {
 			left = resource.MustParse("0")
 		}
 		if left.Cmp(req) < 0 {
-			notEnough = append(notEnough, DetailResourceNotEnough{
-				ResourceName: string(name),
-				Required:     req,
-				Left:         left,
-			})
+			notEnough = append(notEnough, podRequests.notEnough(name, left))
 		}
 	}
 
 	return notEnough
 }
 
-func whyNodeAffinity(pod *v1.Pod, node *v1.Node) []DetailNodeAffinityMismatch {
-	var mismatches []DetailNodeAffinityMismatch
+// podRequests 按调度器的公式拆分 pod 的有效资源请求：
+// max(最大的 init 容器, 业务容器 + sidecar) + overhead
+type podRequests struct {
+	Total          v1.ResourceList
+	Containers     v1.ResourceList
+	Sidecars       v1.ResourceList
+	InitContainers v1.ResourceList
+	Overhead       v1.ResourceList
+	PodLevel       v1.ResourceList
+}
+
+// podLevelResources 是支持在 pod.spec.resources 中设置的资源
+var podLevelResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// computePodRequests 与上游 PodRequests 一致：容器请求考虑 in-place resize，
+// 设置了 pod 级别请求的资源以 pod.spec.resources 为准，最后加上 overhead
+func computePodRequests(pod *v1.Pod) podRequests {
+	ans := podRequests{
+		Total:          v1.ResourceList{},
+		Containers:     v1.ResourceList{},
+		Sidecars:       v1.ResourceList{},
+		InitContainers: v1.ResourceList{},
+		Overhead:       v1.ResourceList{},
+		PodLevel:       v1.ResourceList{},
+	}
+	statuses := containerStatuses(pod)
+	for _, c := range pod.Spec.Containers {
+		addResourceList(ans.Containers, containerRequests(pod, &c, statuses))
+	}
+	// init 容器按顺序启动，普通 init 容器运行时，之前启动的 sidecar 仍在运行
+	for _, c := range pod.Spec.InitContainers {
+		if isRestartableInitContainer(&c) {
+			addResourceList(ans.Sidecars, containerRequests(pod, &c, statuses))
+			maxResourceList(ans.InitContainers, ans.Sidecars)
+			continue
+		}
+		reqs := v1.ResourceList{}
+		addResourceList(reqs, c.Resources.Requests)
+		addResourceList(reqs, ans.Sidecars)
+		maxResourceList(ans.InitContainers, reqs)
+	}
+	addResourceList(ans.Total, ans.Containers)
+	addResourceList(ans.Total, ans.Sidecars)
+	maxResourceList(ans.Total, ans.InitContainers)
+	if pod.Spec.Resources != nil {
+		for _, name := range podLevelResources {
+			if q, ok := pod.Spec.Resources.Requests[name]; ok {
+				ans.PodLevel[name] = q.DeepCopy()
+				ans.Total[name] = q.DeepCopy()
+			}
+		}
+	}
+	addResourceList(ans.Overhead, pod.Spec.Overhead)
+	addResourceList(ans.Total, ans.Overhead)
+	// 每个 pod 占用一个 node allocatable 中的 pods
+	ans.Total[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	return ans
+}
+
+func containerStatuses(pod *v1.Pod) map[string]*v1.ContainerStatus {
+	ans := make(map[string]*v1.ContainerStatus, len(pod.Status.ContainerStatuses)+len(pod.Status.InitContainerStatuses))
+	for i := range pod.Status.ContainerStatuses {
+		ans[pod.Status.ContainerStatuses[i].Name] = &pod.Status.ContainerStatuses[i]
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		ans[pod.Status.InitContainerStatuses[i].Name] = &pod.Status.InitContainerStatuses[i]
+	}
+	return ans
+}
+
+// containerRequests 返回 in-place resize 期间容器实际占用的请求：spec、status.resources 和
+// allocatedResources 中的较大值，resize 不可行时 spec 中的新值永远不会生效，不计入
+func containerRequests(pod *v1.Pod, c *v1.Container, statuses map[string]*v1.ContainerStatus) v1.ResourceList {
+	cs, ok := statuses[c.Name]
+	if !ok || cs.Resources == nil {
+		return c.Resources.Requests
+	}
+	ans := v1.ResourceList{}
+	if !isPodResizeInfeasible(pod) {
+		maxResourceList(ans, c.Resources.Requests)
+	}
+	maxResourceList(ans, cs.Resources.Requests)
+	maxResourceList(ans, cs.AllocatedResources)
+	return ans
+}
+
+func isPodResizeInfeasible(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodResizePending {
+			return c.Reason == v1.PodReasonInfeasible
+		}
+	}
+	return false
+}
+
+func (r *podRequests) notEnough(name v1.ResourceName, left resource.Quantity) DetailResourceNotEnough {
+	ans := DetailResourceNotEnough{
+		ResourceName:   string(name),
+		Required:       r.Total[name],
+		Left:           left,
+		Containers:     r.Containers[name],
+		Sidecars:       r.Sidecars[name],
+		InitContainers: r.InitContainers[name],
+		Overhead:       r.Overhead[name],
+		PodLevel:       r.PodLevel[name],
+		Dominant:       RequestPartContainers,
+	}
+	running := ans.Containers.DeepCopy()
+	running.Add(ans.Sidecars)
+	_, podLevel := r.PodLevel[name]
+	switch {
+	case podLevel:
+		ans.Dominant = RequestPartPodLevel
+	case ans.InitContainers.Cmp(running) > 0:
+		ans.Dominant = RequestPartInitContainers
+	}
+	// 去掉 overhead 或 sidecar 后即可满足时，说明是它们导致了资源不足
+	withoutOverhead := ans.Required.DeepCopy()
+	withoutOverhead.Sub(ans.Overhead)
+	withoutSidecars := ans.Containers.DeepCopy()
+	withoutSidecars.Add(ans.Overhead)
+	switch {
+	case !ans.Overhead.IsZero() && withoutOverhead.Cmp(left) <= 0:
+		ans.Dominant = RequestPartOverhead
+	case ans.Dominant == RequestPartContainers && !ans.Sidecars.IsZero() && withoutSidecars.Cmp(left) <= 0:
+		ans.Dominant = RequestPartSidecars
+	}
+	return ans
+}
+
+func isRestartableInitContainer(c *v1.Container) bool {
+	return c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways
+}
+
+func addResourceList(list, add v1.ResourceList) {
+	for name, qty := range add {
+		if q, ok := list[name]; ok {
+			q.Add(qty)
+			list[name] = q
+		} else {
+			list[name] = qty.DeepCopy()
+		}
+	}
+}
+
+func maxResourceList(list, other v1.ResourceList) {
+	for name, qty := range other {
+		if q, ok := list[name]; !ok || qty.Cmp(q) > 0 {
+			list[name] = qty.DeepCopy()
+		}
+	}
+}
+
+func whyNodeAffinity(pod *v1.Pod, rc *nodev1.RuntimeClass, node *v1.Node) ([]DetailNodeAffinityMismatch, []DetailWarning) {
+	var (
+		mismatches []DetailNodeAffinityMismatch
+		warnings   []DetailWarning
+	)
 
 	// 1. 检查 nodeSelector
 	if len(pod.Spec.NodeSelector) > 0 {
-		term := v1.NodeSelectorTerm{
-			MatchExpressions: make([]v1.NodeSelectorRequirement, 0, len(pod.Spec.NodeSelector)),
-		}
-		for k, v := range pod.Spec.NodeSelector {
-			term.MatchExpressions = append(term.MatchExpressions, v1.NodeSelectorRequirement{
-				Key:      k,
-				Operator: v1.NodeSelectorOpIn,
-				Values:   []string{v},
-			})
+		term := nodeSelectorAsTerm(pod.Spec.NodeSelector)
+		matched, unmatched, err := nodeSelectorTermMatch(node, term)
+		if err != nil {
+			warnings = append(warnings, newWarning(ReasonNodeAffinityMismatch, "invalid nodeSelector: %v", err))
 		}
-		if !nodeSelectorTermMatch(node, term) {
-			mismatches = append(mismatches, DetailNodeAffinityMismatch{Term: term})
+		if !matched {
+			mismatches = append(mismatches, DetailNodeAffinityMismatch{Term: term, Unmatched: unmatched, NodeSelector: true})
 		}
 	}
 
-	// 2. 检查 requiredDuringSchedulingIgnoredDuringExecution
+	// 2. 检查 requiredDuringSchedulingIgnoredDuringExecution，terms 之间是 OR 关系
 	nodeAffinity := pod.Spec.Affinity
 	if nodeAffinity != nil && nodeAffinity.NodeAffinity != nil {
 		selector := nodeAffinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
 		if selector != nil {
-			for _, term := range selector.NodeSelectorTerms {
-				if !nodeSelectorTermMatch(node, term) {
-					mismatches = append(mismatches, DetailNodeAffinityMismatch{Term: term})
+			matched, termMismatches, errs := nodeSelectorTermsMatch(node, selector.NodeSelectorTerms)
+			for _, err := range errs {
+				warnings = append(warnings, newWarning(ReasonNodeAffinityMismatch, "invalid node selector term: %v", err))
+			}
+			if !matched {
+				for _, m := range termMismatches {
+					mismatches = append(mismatches, DetailNodeAffinityMismatch{Term: m.Term, Unmatched: m.Unmatched})
 				}
 			}
 		}
 	}
 
-	return mismatches
+	// 3. 检查 RuntimeClass 的 scheduling.nodeSelector，admission 会将其合并到 pod 的 nodeSelector
+	if selector := runtimeClassNodeSelector(pod, rc); len(selector) > 0 {
+		term := nodeSelectorAsTerm(selector)
+		matched, unmatched, err := nodeSelectorTermMatch(node, term)
+		if err != nil {
+			warnings = append(warnings, newWarning(ReasonNodeAffinityMismatch, "invalid nodeSelector of runtime class %s: %v", rc.Name, err))
+		}
+		if !matched {
+			mismatches = append(mismatches, DetailNodeAffinityMismatch{Term: term, Unmatched: unmatched, NodeSelector: true, RuntimeClass: rc.Name})
+		}
+	}
+
+	return mismatches, warnings
+}
+
+// whyAddedAffinity 检查调度器配置的 addedAffinity，只有 required 部分影响过滤
+func whyAddedAffinity(added *v1.NodeAffinity, node *v1.Node) ([]DetailNodeAffinityMismatch, []DetailWarning) {
+	if added == nil || added.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil, nil
+	}
+	var (
+		mismatches []DetailNodeAffinityMismatch
+		warnings   []DetailWarning
+	)
+	matched, termMismatches, errs := nodeSelectorTermsMatch(node, added.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+	for _, err := range errs {
+		warnings = append(warnings, newWarning(ReasonNodeAffinityMismatch, "invalid addedAffinity term: %v", err))
+	}
+	if !matched {
+		for _, m := range termMismatches {
+			mismatches = append(mismatches, DetailNodeAffinityMismatch{Term: m.Term, Unmatched: m.Unmatched, AddedAffinity: true})
+		}
+	}
+	return mismatches, warnings
+}
+
+// nodeSelectorAsTerm 将 nodeSelector 转换为等价的 node selector term，按 key 排序
+func nodeSelectorAsTerm(selector map[string]string) v1.NodeSelectorTerm {
+	keys := make([]string, 0, len(selector))
+	for k := range selector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	term := v1.NodeSelectorTerm{
+		MatchExpressions: make([]v1.NodeSelectorRequirement, 0, len(selector)),
+	}
+	for _, k := range keys {
+		term.MatchExpressions = append(term.MatchExpressions, v1.NodeSelectorRequirement{
+			Key:      k,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{selector[k]},
+		})
+	}
+	return term
+}
+
+type termMismatch struct {
+	Term      v1.NodeSelectorTerm
+	Unmatched []DetailUnmatchedRequirement
+}
+
+// nodeSelectorTermsMatch terms 之间是 OR 关系，任一 term 匹配即可；
+// 全部不匹配时返回每个 term 中不满足的条件
+func nodeSelectorTermsMatch(node *v1.Node, terms []v1.NodeSelectorTerm) (bool, []termMismatch, []error) {
+	var (
+		mismatches []termMismatch
+		errs       []error
+	)
+	for _, term := range terms {
+		matched, unmatched, err := nodeSelectorTermMatch(node, term)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if matched {
+			return true, nil, errs
+		}
+		mismatches = append(mismatches, termMismatch{Term: term, Unmatched: unmatched})
+	}
+	return false, mismatches, errs
 }
 
-func nodeSelectorTermMatch(node *v1.Node, term v1.NodeSelectorTerm) bool {
-	fields := node.Labels
-	// term 下所有 MatchExpressions 需全匹配
+var nodeSelectorOperators = map[v1.NodeSelectorOperator]selection.Operator{
+	v1.NodeSelectorOpIn:           selection.In,
+	v1.NodeSelectorOpNotIn:        selection.NotIn,
+	v1.NodeSelectorOpExists:       selection.Exists,
+	v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	v1.NodeSelectorOpGt:           selection.GreaterThan,
+	v1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// nodeSelectorTermMatch 与上游 nodeaffinity 保持一致：
+// term 下所有 MatchExpressions 和 MatchFields 需全匹配，空 term 不匹配任何 node，
+// 非法的 term 不匹配任何 node 并返回 error。不匹配时同时返回不满足的条件
+func nodeSelectorTermMatch(node *v1.Node, term v1.NodeSelectorTerm) (bool, []DetailUnmatchedRequirement, error) {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false, nil, nil
+	}
+	var (
+		labelReqs []labels.Requirement
+		fieldSels []fields.Selector
+		errs      []error
+	)
 	for _, req := range term.MatchExpressions {
-		value, exists := fields[req.Key]
-		switch req.Operator {
-		case v1.NodeSelectorOpIn:
-			if !exists {
-				return false
-			}
-			found := false
-			for _, v := range req.Values {
-				if value == v {
-					found = true
-					break
-				}
-			}
-			if !found {
-				return false
-			}
-		case v1.NodeSelectorOpNotIn:
-			if !exists {
-				continue
-			}
-			for _, v := range req.Values {
-				if value == v {
-					return false
-				}
-			}
-		case v1.NodeSelectorOpExists:
-			if !exists {
-				return false
-			}
-		case v1.NodeSelectorOpDoesNotExist:
-			if exists {
-				return false
-			}
-		case v1.NodeSelectorOpGt, v1.NodeSelectorOpLt:
-			if !exists {
-				return false
-			}
-			log.Println("NodeSelectorOpGt and NodeSelectorOpLt unimplemented")
+		r, err := nodeSelectorRequirementAsLabelRequirement(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		labelReqs = append(labelReqs, *r)
+	}
+	for _, req := range term.MatchFields {
+		sel, err := nodeSelectorRequirementAsFieldSelector(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
+		fieldSels = append(fieldSels, sel)
+	}
+	if len(errs) > 0 {
+		return false, nil, errors.Join(errs...)
+	}
+	var (
+		unmatched  []DetailUnmatchedRequirement
+		nodeLabels = labels.Set(node.Labels)
+		nodeFields = fields.Set{metav1.ObjectNameField: node.Name}
+	)
+	for i, r := range labelReqs {
+		if !r.Matches(nodeLabels) {
+			value, exists := node.Labels[r.Key()]
+			unmatched = append(unmatched, DetailUnmatchedRequirement{
+				Requirement: term.MatchExpressions[i],
+				NodeHasKey:  exists,
+				NodeValue:   value,
+			})
+		}
+	}
+	for i, sel := range fieldSels {
+		if !sel.Matches(nodeFields) {
+			unmatched = append(unmatched, DetailUnmatchedRequirement{
+				Requirement: term.MatchFields[i],
+				Field:       true,
+				NodeHasKey:  true,
+				NodeValue:   node.Name,
+			})
+		}
+	}
+	return len(unmatched) == 0, unmatched, nil
+}
+
+func nodeSelectorRequirementAsLabelRequirement(req v1.NodeSelectorRequirement) (*labels.Requirement, error) {
+	op, ok := nodeSelectorOperators[req.Operator]
+	if !ok {
+		return nil, fmt.Errorf("%q is not a valid label selector operator", req.Operator)
+	}
+	return labels.NewRequirement(req.Key, op, req.Values)
+}
+
+// nodeSelectorRequirementAsFieldSelector 上游仅支持 metadata.name 的 In 和 NotIn，且只能有一个值
+func nodeSelectorRequirementAsFieldSelector(req v1.NodeSelectorRequirement) (fields.Selector, error) {
+	if req.Key != metav1.ObjectNameField {
+		return nil, fmt.Errorf("%q is not a valid field selector key", req.Key)
+	}
+	if len(req.Values) != 1 {
+		return nil, fmt.Errorf("unexpected number of value (%d) for node field selector operator %q", len(req.Values), req.Operator)
 	}
-	if len(term.MatchFields) > 0 {
-		log.Println("MatchFields unimplemented")
+	switch req.Operator {
+	case v1.NodeSelectorOpIn:
+		return fields.OneTermEqualSelector(req.Key, req.Values[0]), nil
+	case v1.NodeSelectorOpNotIn:
+		return fields.OneTermNotEqualSelector(req.Key, req.Values[0]), nil
+	default:
+		return nil, fmt.Errorf("%q is not a valid node field selector operator", req.Operator)
 	}
-	return true
 }
 
-func whyNodeTaint(pod *v1.Pod, node *v1.Node) []DetailTaintNotTolerated {
-	var notTolerated []DetailTaintNotTolerated
-	tolerations := pod.Spec.Tolerations
+func whyNodeTaint(pod *v1.Pod, rc *nodev1.RuntimeClass, node *v1.Node) ([]DetailTaintNotTolerated, []DetailTaintNotTolerated) {
+	var (
+		notTolerated     []DetailTaintNotTolerated
+		softNotTolerated []DetailTaintNotTolerated
+	)
+	tolerations := podTolerations(pod, rc)
 	for _, taint := range node.Spec.Taints {
-		// 只考虑影响调度的 taint
-		if taint.Effect == v1.TaintEffectNoSchedule {
-			if !toleratesTaint(tolerations, taint) {
-				notTolerated = append(notTolerated, DetailTaintNotTolerated{Taint: taint})
-			}
+		if toleratesTaint(tolerations, taint) {
+			continue
+		}
+		switch taint.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectNoExecute:
+			notTolerated = append(notTolerated, DetailTaintNotTolerated{Taint: taint})
+		case v1.TaintEffectPreferNoSchedule:
+			// 只影响打分，不阻止调度
+			softNotTolerated = append(softNotTolerated, DetailTaintNotTolerated{Taint: taint})
 		}
 	}
-	return notTolerated
+	return notTolerated, softNotTolerated
 }
 
+// toleratesTaint 与上游一致：toleration 的 key 为空时匹配所有 key，effect 为空时匹配所有 effect
 func toleratesTaint(tolerations []v1.Toleration, taint v1.Taint) bool {
-	for _, tol := range tolerations {
-		// 键不等一定不容忍
-		if tol.Key != taint.Key {
-			continue
-		}
-		switch tol.Operator {
-		case v1.TolerationOpEqual, "":
-			// Operator: "Equal" 或空，key、value 必须相等
-			if tol.Value == taint.Value {
-				if tol.Effect == "" || tol.Effect == taint.Effect {
-					return true
-				}
-			}
-		case v1.TolerationOpExists:
-			// Operator: "Exists"，key 必须相等即可
-			if tol.Effect == "" || tol.Effect == taint.Effect {
-				return true
-			}
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(&taint) {
+			return true
 		}
 	}
 	return false
 }
 
-func whyPodAffinity(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node) []DetailPodAffinityMismatch {
+func whyPodAffinity(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailPodAffinityMismatch {
 	var mismatches []DetailPodAffinityMismatch
 	affinity := pod.Spec.Affinity
 	if affinity == nil || affinity.PodAffinity == nil {
 		return nil
 	}
 	terms := affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(terms) == 0 {
+		return nil
+	}
+	// 与上游一致，已有 pod 需同时匹配所有 term 才计数
+	podMatchesAllTerms := func(p *v1.Pod) bool {
+		for i := range terms {
+			if !podMatchesAffinityTerm(snap, pod, p, &terms[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	var unmatchedTerms []DetailPodAffinityMismatch
 	for _, term := range terms {
 		topologyKey := term.TopologyKey
-		if _, ok := node.Labels[topologyKey]; !ok {
-			continue // topologyKey 不存在，跳过
+		topologyValue, ok := node.Labels[topologyKey]
+		if !ok {
+			// node 必须带有所有 term 的 topologyKey
+			mismatches = append(mismatches, DetailPodAffinityMismatch{
+				Term:               term,
+				Selector:           affinityTermSelectorString(pod, &term),
+				Namespaces:         snap.termNamespaces(pod.Namespace, &term),
+				MissingTopologyKey: true,
+			})
+			continue
 		}
 		matched := false
-		for _, np := range nodePods {
-			if podMatchesAffinityTerm(pod.Namespace, &np, &term) {
+		domainPods := snap.domainPods(topologyKey, topologyValue)
+		for i := range domainPods {
+			if podMatchesAllTerms(&domainPods[i]) {
 				matched = true
 				break
 			}
 		}
 		if !matched {
-			mismatches = append(mismatches, DetailPodAffinityMismatch{
-				Term: term,
+			unmatchedTerms = append(unmatchedTerms, DetailPodAffinityMismatch{
+				Term:          term,
+				Selector:      affinityTermSelectorString(pod, &term),
+				Namespaces:    snap.termNamespaces(pod.Namespace, &term),
+				TopologyValue: topologyValue,
 			})
 		}
 	}
-	return mismatches
+	if len(mismatches) > 0 || len(unmatchedTerms) == 0 {
+		return mismatches
+	}
+	// 一组互相亲和的 pod 中的第一个：集群中没有任何 pod 匹配，且 pod 匹配自己的所有 term 时允许调度
+	if podMatchesAllTerms(pod) && !anyPodMatchesAllTerms(snap, terms, podMatchesAllTerms) {
+		return nil
+	}
+	return unmatchedTerms
 }
 
-func whyPodAntiAffinity(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node) []DetailPodAntiAffinityMismatch {
+func anyPodMatchesAllTerms(snap *snapshot, terms []v1.PodAffinityTerm, match func(*v1.Pod) bool) bool {
+	for _, term := range terms {
+		pods := snap.topologyPods(term.TopologyKey)
+		for i := range pods {
+			if match(&pods[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func whyPodAntiAffinity(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailPodAntiAffinityMismatch {
 	var mismatches []DetailPodAntiAffinityMismatch
 	affinity := pod.Spec.Affinity
 	if affinity == nil || affinity.PodAntiAffinity == nil {
@@ -273,17 +620,21 @@ func whyPodAntiAffinity(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node) []DetailP
 	}
 	terms := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
 	for _, term := range terms {
-		// 需要调度到同一 node 的 pod 都不能和 term 匹配
+		// 同一拓扑域内的 pod 都不能和 term 匹配
 		topologyKey := term.TopologyKey
-		if _, ok := node.Labels[topologyKey]; !ok {
+		topologyValue, ok := node.Labels[topologyKey]
+		if !ok {
 			continue // topologyKey 不存在，跳过
 		}
-		for _, np := range nodePods {
-			if podMatchesAffinityTerm(pod.Namespace, &np, &term) {
+		domainPods := snap.domainPods(topologyKey, topologyValue)
+		for _, np := range domainPods {
+			if podMatchesAffinityTerm(snap, pod, &np, &term) {
 				mismatches = append(mismatches, DetailPodAntiAffinityMismatch{
-					Term:      term,
-					Namespace: np.Namespace,
-					PodName:   np.Name,
+					Term:          term,
+					Namespace:     np.Namespace,
+					PodName:       np.Name,
+					PodNodeName:   np.Spec.NodeName,
+					TopologyValue: topologyValue,
 				})
 			}
 		}
@@ -291,63 +642,140 @@ func whyPodAntiAffinity(pod *v1.Pod, nodePods []v1.Pod, node *v1.Node) []DetailP
 	return mismatches
 }
 
-func podMatchesAffinityTerm(matchingNamespace string, pod *v1.Pod, term *v1.PodAffinityTerm) bool {
-	// 1. 匹配 namespace
-	nsMatch := false
-	// NamespaceSelector 或 Namespaces（K8s 任意一个命中即可）
-	if len(term.Namespaces) > 0 {
-		for _, ns := range term.Namespaces {
-			if pod.Namespace == ns {
-				nsMatch = true
-				break
+// whyExistingPodAntiAffinity 检查反方向：已有 pod 的 anti-affinity 是否排斥待调度的 pod。
+// 与上游一致，按 node 的每个 label 查找预先计算的拓扑域
+func whyExistingPodAntiAffinity(pod *v1.Pod, snap *snapshot, node *v1.Node) []DetailExistingPodAntiAffinity {
+	var mismatches []DetailExistingPodAntiAffinity
+	if len(snap.existingAntiAffinity) == 0 {
+		return nil
+	}
+	for k, v := range node.Labels {
+		mismatches = append(mismatches, snap.existingAntiAffinity[topologyPair{key: k, value: v}]...)
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Namespace != mismatches[j].Namespace {
+			return mismatches[i].Namespace < mismatches[j].Namespace
+		}
+		if mismatches[i].PodName != mismatches[j].PodName {
+			return mismatches[i].PodName < mismatches[j].PodName
+		}
+		return mismatches[i].Term.TopologyKey < mismatches[j].Term.TopologyKey
+	})
+	return mismatches
+}
+
+// existingAntiAffinity 返回 node 上的已有 pod 中 anti-affinity 排斥待调度 pod 的 term
+func existingAntiAffinity(pod *v1.Pod, snap *snapshot, existingNode *v1.Node, nodePods []v1.Pod) []DetailExistingPodAntiAffinity {
+	var ans []DetailExistingPodAntiAffinity
+	for i := range nodePods {
+		ep := &nodePods[i]
+		affinity := ep.Spec.Affinity
+		if affinity == nil || affinity.PodAntiAffinity == nil {
+			continue
+		}
+		for _, term := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			topologyValue, ok := existingNode.Labels[term.TopologyKey]
+			if !ok {
+				continue
 			}
+			if !podMatchesAffinityTerm(snap, ep, pod, &term) {
+				continue
+			}
+			ans = append(ans, DetailExistingPodAntiAffinity{
+				Term:          term,
+				Selector:      affinityTermSelectorString(ep, &term),
+				Namespace:     ep.Namespace,
+				PodName:       ep.Name,
+				PodNodeName:   existingNode.Name,
+				TopologyValue: topologyValue,
+			})
 		}
-	} else if term.NamespaceSelector != nil {
-		log.Printf("PodAffinityTerm.NamespaceSelector unimplmented")
-		nsMatch = true
-		// sel, err := metav1.LabelSelectorAsSelector(term.NamespaceSelector)
-		// // 这里其实应该是 namespace 的 labels，但目前不做 namespace labels 查询，简单处理
-		// if err == nil && sel.Matches(labels.Set(pod.Labels)) {
-		// 	nsMatch = true
-		// }
-	} else {
-		// 默认为本 namespace
-		if pod.Namespace == matchingNamespace {
-			nsMatch = true
-		}
-	}
-	if !nsMatch {
+	}
+	return ans
+}
+
+// podMatchesAffinityTerm 判断 pod 是否匹配 owner 定义的 term
+func podMatchesAffinityTerm(snap *snapshot, owner *v1.Pod, pod *v1.Pod, term *v1.PodAffinityTerm) bool {
+	// 1. 匹配 namespace
+	if !snap.termMatchesNamespace(owner.Namespace, pod.Namespace, term) {
 		return false
 	}
 
 	// 2. 匹配 labelSelector
-	if term.LabelSelector != nil {
-		sel, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
-		if err != nil {
-			return false
-		}
-		if !sel.Matches(labels.Set(pod.Labels)) {
-			return false
+	sel, err := affinityTermSelector(owner, term)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(labels.Set(pod.Labels))
+}
+
+// affinityTermSelector 处理 matchLabelKeys 和 mismatchLabelKeys：取 owner 上对应 label 的值，
+// 分别以 In 和 NotIn 合并进 labelSelector，owner 上没有的 key 忽略。
+// 上游 kube-apiserver 在 labelSelector 为 nil 时不合并，nil labelSelector 不匹配任何 pod
+func affinityTermSelector(owner *v1.Pod, term *v1.PodAffinityTerm) (labels.Selector, error) {
+	if term.LabelSelector == nil {
+		return labels.Nothing(), nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	merge := func(keys []string, op selection.Operator) error {
+		for _, key := range keys {
+			value, ok := owner.Labels[key]
+			if !ok {
+				continue
+			}
+			r, err := labels.NewRequirement(key, op, []string{value})
+			if err != nil {
+				return err
+			}
+			sel = sel.Add(*r)
 		}
+		return nil
+	}
+	if err := merge(term.MatchLabelKeys, selection.In); err != nil {
+		return nil, err
+	}
+	if err := merge(term.MismatchLabelKeys, selection.NotIn); err != nil {
+		return nil, err
+	}
+	return sel, nil
+}
+
+func affinityTermSelectorString(owner *v1.Pod, term *v1.PodAffinityTerm) string {
+	sel, err := affinityTermSelector(owner, term)
+	if err != nil {
+		return fmt.Sprintf("<invalid: %v>", err)
 	}
-	return true
+	return sel.String()
 }
 
-func whyPvAffinity(node *v1.Node, pvs []v1.PersistentVolume) []DetailPvAffinityMismatch {
-	var mismatches []DetailPvAffinityMismatch
+func whyPvAffinity(node *v1.Node, pvs []v1.PersistentVolume) ([]DetailPvAffinityMismatch, []DetailWarning) {
+	var (
+		mismatches []DetailPvAffinityMismatch
+		warnings   []DetailWarning
+	)
 	for _, pv := range pvs {
 		na := pv.Spec.NodeAffinity
 		if na == nil || na.Required == nil {
 			continue
 		}
-		for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
-			if !nodeSelectorTermMatch(node, term) {
-				mismatches = append(mismatches, DetailPvAffinityMismatch{
-					PvName: pv.Name,
-					Term:   term,
-				})
-			}
+		// 与 pod 的 node affinity 相同，terms 之间是 OR 关系
+		matched, termMismatches, errs := nodeSelectorTermsMatch(node, na.Required.NodeSelectorTerms)
+		for _, err := range errs {
+			warnings = append(warnings, newWarning(ReasonPvAffinityMismatch, "invalid node selector term of pv %s: %v", pv.Name, err))
+		}
+		if matched {
+			continue
+		}
+		for _, m := range termMismatches {
+			mismatches = append(mismatches, DetailPvAffinityMismatch{
+				PvName:    pv.Name,
+				Term:      m.Term,
+				Unmatched: m.Unmatched,
+			})
 		}
 	}
-	return mismatches
+	return mismatches, warnings
 }
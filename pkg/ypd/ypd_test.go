@@ -0,0 +1,1280 @@
+package ypd
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	resourcev1beta1 "k8s.io/api/resource/v1beta1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func container(cpu string) v1.Container {
+	return v1.Container{
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)},
+		},
+	}
+}
+
+func sidecar(cpu string) v1.Container {
+	c := container(cpu)
+	always := v1.ContainerRestartPolicyAlways
+	c.RestartPolicy = &always
+	return c
+}
+
+func testNode(name string, labels map[string]string) v1.Node {
+	n := v1.Node{}
+	n.Name = name
+	n.Labels = labels
+	n.Status.Allocatable = v1.ResourceList{v1.ResourcePods: resource.MustParse("110")}
+	return n
+}
+
+func zoneNode(name, zone string) v1.Node {
+	return testNode(name, map[string]string{"zone": zone})
+}
+
+func TestComputePodRequests(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     v1.PodSpec
+		status   v1.PodStatus
+		total    string
+		left     string
+		dominant RequestPart
+	}{
+		{
+			name:     "containers only",
+			spec:     v1.PodSpec{Containers: []v1.Container{container("1"), container("500m")}},
+			total:    "1500m",
+			dominant: RequestPartContainers,
+		},
+		{
+			name: "heavy init container",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{container("4")},
+				Containers:     []v1.Container{container("1")},
+			},
+			total:    "4",
+			dominant: RequestPartInitContainers,
+		},
+		{
+			name: "sidecar adds to containers",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("1"), container("2")},
+				Containers:     []v1.Container{container("1")},
+			},
+			// init 阶段 sidecar(1) + init(2) = 3 > sidecar(1) + containers(1) = 2
+			total:    "3",
+			dominant: RequestPartInitContainers,
+		},
+		{
+			name: "sidecar started after init container",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{container("2"), sidecar("1")},
+				Containers:     []v1.Container{container("2")},
+			},
+			total:    "3",
+			dominant: RequestPartContainers,
+		},
+		{
+			name: "overhead",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{container("1")},
+				Overhead:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")},
+			},
+			total:    "1250m",
+			dominant: RequestPartContainers,
+		},
+		{
+			name: "overhead pushes over left",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{container("1")},
+				Overhead:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")},
+			},
+			total:    "1250m",
+			left:     "1100m",
+			dominant: RequestPartOverhead,
+		},
+		{
+			name: "sidecar pushes over left",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{sidecar("500m")},
+				Containers:     []v1.Container{container("1")},
+			},
+			total:    "1500m",
+			left:     "1",
+			dominant: RequestPartSidecars,
+		},
+		{
+			name: "pod level requests take precedence",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{container("1"), container("1")},
+				Resources:  &v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1500m")}},
+				Overhead:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")},
+			},
+			total:    "1750m",
+			dominant: RequestPartPodLevel,
+		},
+		{
+			name: "resize down not yet allocated",
+			spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Resources: container("1").Resources}}},
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+				Name:               "app",
+				AllocatedResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				Resources:          &v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+			}}},
+			total:    "2",
+			dominant: RequestPartContainers,
+		},
+		{
+			name: "infeasible resize up",
+			spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Resources: container("8").Resources}}},
+			status: v1.PodStatus{
+				Conditions: []v1.PodCondition{{Type: v1.PodResizePending, Reason: v1.PodReasonInfeasible}},
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name:               "app",
+					AllocatedResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+					Resources:          &v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+				}},
+			},
+			total:    "1",
+			dominant: RequestPartContainers,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: c.spec, Status: c.status}
+			reqs := computePodRequests(pod)
+			total := reqs.Total[v1.ResourceCPU]
+			if total.Cmp(resource.MustParse(c.total)) != 0 {
+				t.Fatalf("want total %s, got %s", c.total, total.String())
+			}
+			left := resource.MustParse("0")
+			if len(c.left) > 0 {
+				left = resource.MustParse(c.left)
+			}
+			d := reqs.notEnough(v1.ResourceCPU, left)
+			if d.Dominant != c.dominant {
+				t.Fatalf("want dominant %s, got %s", c.dominant, d.Dominant)
+			}
+		})
+	}
+}
+
+func TestWhyPendingSkipsFinishedPods(t *testing.T) {
+	node := testNode("n1", nil)
+	node.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("2")
+
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{container("1")}}}
+
+	finished := v1.Pod{Spec: v1.PodSpec{NodeName: "n1", Containers: []v1.Container{container("2")}}}
+	finished.Status.Phase = v1.PodSucceeded
+
+	now := metav1.Now()
+	terminating := v1.Pod{Spec: v1.PodSpec{NodeName: "n1", Containers: []v1.Container{container("1500m")}}}
+	terminating.Name = "old"
+	terminating.DeletionTimestamp = &now
+
+	ans := WhyPending(pod, &Cluster{Pods: []v1.Pod{finished, terminating}, Nodes: []v1.Node{node}})
+	if len(ans) != 1 {
+		t.Fatalf("want 1 detail, got %d", len(ans))
+	}
+	d := ans[0]
+	if len(d.ResourceNotEnough) != 1 {
+		t.Fatalf("terminating pod should still use resources, got %+v", d.ResourceNotEnough)
+	}
+	if len(d.WillFreeSoon) != 1 || d.WillFreeSoon[0].PodName != "old" {
+		t.Fatalf("want terminating pod in will free soon, got %+v", d.WillFreeSoon)
+	}
+	if !d.ResourceEnoughAfterTermination {
+		t.Fatal("want resources enough after termination")
+	}
+}
+
+func TestNodeSelectorTermMatch(t *testing.T) {
+	node := &v1.Node{}
+	node.Name = "n1"
+	node.Labels = map[string]string{"gpu-count": "4", "zone": "a", "bad": "x"}
+
+	expr := func(key string, op v1.NodeSelectorOperator, values ...string) v1.NodeSelectorTerm {
+		return v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: key, Operator: op, Values: values}}}
+	}
+	field := func(op v1.NodeSelectorOperator, values ...string) v1.NodeSelectorTerm {
+		return v1.NodeSelectorTerm{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: op, Values: values}}}
+	}
+	cases := []struct {
+		name    string
+		term    v1.NodeSelectorTerm
+		matched bool
+		invalid bool
+	}{
+		{name: "empty term", term: v1.NodeSelectorTerm{}},
+		{name: "in", term: expr("zone", v1.NodeSelectorOpIn, "a", "b"), matched: true},
+		{name: "not in missing label", term: expr("rack", v1.NodeSelectorOpNotIn, "r1"), matched: true},
+		{name: "gt", term: expr("gpu-count", v1.NodeSelectorOpGt, "3"), matched: true},
+		{name: "gt equal", term: expr("gpu-count", v1.NodeSelectorOpGt, "4")},
+		{name: "lt", term: expr("gpu-count", v1.NodeSelectorOpLt, "5"), matched: true},
+		{name: "gt missing label", term: expr("cpu-count", v1.NodeSelectorOpGt, "1")},
+		{name: "gt non-integer label", term: expr("bad", v1.NodeSelectorOpGt, "1")},
+		{name: "gt non-integer value", term: expr("gpu-count", v1.NodeSelectorOpGt, "x"), invalid: true},
+		{name: "gt two values", term: expr("gpu-count", v1.NodeSelectorOpGt, "1", "2"), invalid: true},
+		{name: "in without values", term: expr("zone", v1.NodeSelectorOpIn), invalid: true},
+		{name: "field in", term: field(v1.NodeSelectorOpIn, "n1"), matched: true},
+		{name: "field in other", term: field(v1.NodeSelectorOpIn, "n2")},
+		{name: "field not in", term: field(v1.NodeSelectorOpNotIn, "n2"), matched: true},
+		{name: "field two values", term: field(v1.NodeSelectorOpIn, "n1", "n2"), invalid: true},
+		{name: "field exists", term: field(v1.NodeSelectorOpExists), invalid: true},
+		{
+			name: "unsupported field key",
+			term: v1.NodeSelectorTerm{MatchFields: []v1.NodeSelectorRequirement{
+				{Key: "metadata.uid", Operator: v1.NodeSelectorOpIn, Values: []string{"x"}},
+			}},
+			invalid: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			matched, _, err := nodeSelectorTermMatch(node, c.term)
+			if matched != c.matched {
+				t.Fatalf("want matched %v, got %v", c.matched, matched)
+			}
+			if (err != nil) != c.invalid {
+				t.Fatalf("want invalid %v, got err %v", c.invalid, err)
+			}
+		})
+	}
+}
+
+func TestWhyNodeAffinityOrTerms(t *testing.T) {
+	node := &v1.Node{}
+	node.Labels = map[string]string{"zone": "c"}
+
+	zoneIn := func(zones ...string) v1.NodeSelectorTerm {
+		return v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{
+			{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: zones},
+		}}
+	}
+	podWithTerms := func(terms ...v1.NodeSelectorTerm) *v1.Pod {
+		return &v1.Pod{Spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: terms},
+		}}}}
+	}
+
+	mismatches, _ := whyNodeAffinity(podWithTerms(zoneIn("a"), zoneIn("c")), nil, node)
+	if len(mismatches) != 0 {
+		t.Fatalf("any matched term should be enough, got %+v", mismatches)
+	}
+
+	mismatches, _ = whyNodeAffinity(podWithTerms(zoneIn("a", "b"), zoneIn("d")), nil, node)
+	if len(mismatches) != 2 {
+		t.Fatalf("want every term reported, got %+v", mismatches)
+	}
+	u := mismatches[0].Unmatched
+	if len(u) != 1 || !u[0].NodeHasKey || u[0].NodeValue != "c" {
+		t.Fatalf("want node value c reported, got %+v", u)
+	}
+}
+
+func TestPodAffinityTopologyDomain(t *testing.T) {
+	nodes := []v1.Node{zoneNode("n1", "a"), zoneNode("n2", "a"), zoneNode("n3", "b")}
+	db := v1.Pod{Spec: v1.PodSpec{NodeName: "n2"}}
+	db.Namespace, db.Name = "default", "db"
+	db.Labels = map[string]string{"app": "db"}
+
+	term := v1.PodAffinityTerm{
+		TopologyKey:   "zone",
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{Affinity: &v1.Affinity{
+		PodAffinity: &v1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}},
+	}}}
+	pod.Namespace, pod.Name = "default", "web"
+
+	ans := WhyPending(pod, &Cluster{Pods: []v1.Pod{db}, Nodes: nodes})
+	if len(ans[0].PodAffinityMismatch) != 0 {
+		t.Fatalf("zone-mate n2 runs db, n1 should match, got %+v", ans[0].PodAffinityMismatch)
+	}
+	if len(ans[2].PodAffinityMismatch) != 1 || ans[2].PodAffinityMismatch[0].TopologyValue != "b" {
+		t.Fatalf("zone b has no db, got %+v", ans[2].PodAffinityMismatch)
+	}
+
+	pod.Spec.Affinity = &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}},
+	}
+	ans = WhyPending(pod, &Cluster{Pods: []v1.Pod{db}, Nodes: nodes})
+	anti := ans[0].PodAntiAffinityMismatch
+	if len(anti) != 1 || anti[0].PodName != "db" || anti[0].PodNodeName != "n2" {
+		t.Fatalf("want conflict with db on n2, got %+v", anti)
+	}
+	if len(ans[2].PodAntiAffinityMismatch) != 0 {
+		t.Fatalf("zone b has no db, got %+v", ans[2].PodAntiAffinityMismatch)
+	}
+}
+
+func TestExistingPodAntiAffinity(t *testing.T) {
+	nodes := []v1.Node{zoneNode("n1", "a"), zoneNode("n2", "a"), zoneNode("n3", "b")}
+	loner := v1.Pod{Spec: v1.PodSpec{NodeName: "n2", Affinity: &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+			TopologyKey:   "zone",
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		}}},
+	}}}
+	loner.Namespace, loner.Name = "default", "loner"
+
+	pod := &v1.Pod{}
+	pod.Namespace, pod.Name = "default", "web"
+	pod.Labels = map[string]string{"app": "web"}
+
+	ans := WhyPending(pod, &Cluster{Pods: []v1.Pod{loner}, Nodes: nodes})
+	got := ans[0].ExistingPodAntiAffinity
+	if len(got) != 1 || got[0].PodName != "loner" || got[0].PodNodeName != "n2" {
+		t.Fatalf("want n1 excluded by loner on n2, got %+v", got)
+	}
+	if ans[0].Schedulable {
+		t.Fatal("n1 should not be schedulable")
+	}
+	if len(ans[2].ExistingPodAntiAffinity) != 0 || !ans[2].Schedulable {
+		t.Fatalf("zone b should be schedulable, got %+v", ans[2])
+	}
+}
+
+func TestTopologySpread(t *testing.T) {
+	newPod := func(name, node, hash string) v1.Pod {
+		p := v1.Pod{Spec: v1.PodSpec{NodeName: node}}
+		p.Namespace, p.Name = "default", name
+		p.Labels = map[string]string{"app": "web", "pod-template-hash": hash}
+		return p
+	}
+	nodes := []v1.Node{zoneNode("n1", "a"), zoneNode("n2", "b"), zoneNode("n3", "c")}
+	pods := []v1.Pod{
+		newPod("w1", "n1", "v2"),
+		newPod("w2", "n1", "v2"),
+		newPod("w3", "n2", "v2"),
+		// 旧版本的 pod 因 matchLabelKeys 不计数
+		newPod("old", "n3", "v1"),
+	}
+
+	pod := newPod("web", "", "v2")
+	pod.Spec.TopologySpreadConstraints = []v1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       "zone",
+		WhenUnsatisfiable: v1.DoNotSchedule,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		MatchLabelKeys:    []string{"pod-template-hash"},
+	}}
+
+	ans := WhyPending(&pod, &Cluster{Pods: pods, Nodes: nodes})
+	got := ans[0].TopologySpreadMismatch
+	if len(got) != 1 || got[0].Skew != 3 || got[0].DomainCounts["a"] != 2 || got[0].DomainCounts["c"] != 0 {
+		t.Fatalf("want skew 3 on zone a, got %+v", got)
+	}
+	if len(ans[1].TopologySpreadMismatch) != 1 {
+		t.Fatalf("want skew 2 on zone b, got %+v", ans[1].TopologySpreadMismatch)
+	}
+	if len(ans[2].TopologySpreadMismatch) != 0 {
+		t.Fatalf("zone c should fit, got %+v", ans[2].TopologySpreadMismatch)
+	}
+
+	pods[3] = newPod("w4", "n3", "v2")
+	ans = WhyPending(&pod, &Cluster{Pods: pods, Nodes: nodes})
+	if len(ans[1].TopologySpreadMismatch) != 0 {
+		t.Fatalf("zone b should fit, got %+v", ans[1].TopologySpreadMismatch)
+	}
+
+	// minDomains 大于现有拓扑域数量时，全局最小值视为 0
+	minDomains := int32(5)
+	pod.Spec.TopologySpreadConstraints[0].MinDomains = &minDomains
+	ans = WhyPending(&pod, &Cluster{Pods: pods, Nodes: nodes})
+	if len(ans[1].TopologySpreadMismatch) != 1 || ans[1].TopologySpreadMismatch[0].Skew != 2 {
+		t.Fatalf("want skew 2 on zone b with minDomains, got %+v", ans[1].TopologySpreadMismatch)
+	}
+}
+
+func TestPodAffinityNamespaceSelector(t *testing.T) {
+	node := zoneNode("n1", "a")
+
+	newNs := func(name, team string) v1.Namespace {
+		ns := v1.Namespace{}
+		ns.Name = name
+		ns.Labels = map[string]string{"team": team}
+		return ns
+	}
+	db := v1.Pod{Spec: v1.PodSpec{NodeName: "n1"}}
+	db.Namespace, db.Name = "data", "db"
+	db.Labels = map[string]string{"app": "db"}
+
+	term := v1.PodAffinityTerm{
+		TopologyKey:       "zone",
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}},
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{Affinity: &v1.Affinity{
+		PodAffinity: &v1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{term}},
+	}}}
+	pod.Namespace, pod.Name = "web", "web"
+	cluster := &Cluster{
+		Pods:       []v1.Pod{db},
+		Nodes:      []v1.Node{node},
+		Namespaces: []v1.Namespace{newNs("web", "web"), newNs("data", "data")},
+	}
+
+	got := WhyPending(pod, cluster)[0].PodAffinityMismatch
+	if len(got) != 1 || len(got[0].Namespaces) != 1 || got[0].Namespaces[0] != "web" {
+		t.Fatalf("want term resolved to namespace web, got %+v", got)
+	}
+
+	// 空 selector 匹配所有 namespace
+	pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].NamespaceSelector = &metav1.LabelSelector{}
+	if got := WhyPending(pod, cluster)[0].PodAffinityMismatch; len(got) != 0 {
+		t.Fatalf("empty namespace selector should match db, got %+v", got)
+	}
+
+	// namespaces 与 namespaceSelector 是 OR 关系
+	term.Namespaces = []string{"data"}
+	pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0] = term
+	if got := WhyPending(pod, cluster)[0].PodAffinityMismatch; len(got) != 0 {
+		t.Fatalf("namespaces should be ORed with namespace selector, got %+v", got)
+	}
+}
+
+func TestPodAntiAffinityMatchLabelKeys(t *testing.T) {
+	node := testNode("n1", map[string]string{"kubernetes.io/hostname": "n1"})
+
+	newPod := func(name, hash string) v1.Pod {
+		p := v1.Pod{}
+		p.Namespace, p.Name = "default", name
+		p.Labels = map[string]string{"app": "web", "pod-template-hash": hash}
+		return p
+	}
+	old := newPod("old", "v1")
+	old.Spec.NodeName = "n1"
+
+	pod := newPod("web", "v2")
+	pod.Spec.Affinity = &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+			TopologyKey:    "kubernetes.io/hostname",
+			LabelSelector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			MatchLabelKeys: []string{"pod-template-hash"},
+		}},
+	}}
+	cluster := &Cluster{Pods: []v1.Pod{old}, Nodes: []v1.Node{node}}
+	if got := WhyPending(&pod, cluster)[0].PodAntiAffinityMismatch; len(got) != 0 {
+		t.Fatalf("pod of older ReplicaSet should be ignored, got %+v", got)
+	}
+
+	term := &pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+	term.MatchLabelKeys = nil
+	term.MismatchLabelKeys = []string{"pod-template-hash"}
+	got := WhyPending(&pod, cluster)[0].PodAntiAffinityMismatch
+	if len(got) != 1 || got[0].PodName != "old" {
+		t.Fatalf("want conflict with pod of other ReplicaSet, got %+v", got)
+	}
+
+	// 与 kube-apiserver 一致，labelSelector 为 nil 时不合并 matchLabelKeys，term 不匹配任何 pod
+	same := newPod("same", "v2")
+	same.Spec.NodeName = "n1"
+	term.LabelSelector = nil
+	term.MatchLabelKeys = []string{"pod-template-hash"}
+	term.MismatchLabelKeys = nil
+	cluster.Pods = []v1.Pod{same}
+	if got := WhyPending(&pod, cluster)[0].PodAntiAffinityMismatch; len(got) != 0 {
+		t.Fatalf("nil labelSelector should match nothing, got %+v", got)
+	}
+}
+
+func TestWhyNodeTaint(t *testing.T) {
+	node := &v1.Node{Spec: v1.NodeSpec{Taints: []v1.Taint{
+		{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule},
+		{Key: "node.kubernetes.io/unreachable", Effect: v1.TaintEffectNoExecute},
+		{Key: "spot", Value: "true", Effect: v1.TaintEffectPreferNoSchedule},
+	}}}
+
+	pod := &v1.Pod{}
+	hard, soft := whyNodeTaint(pod, nil, node)
+	if len(hard) != 2 || len(soft) != 1 {
+		t.Fatalf("want 2 blocking and 1 soft taints, got %+v %+v", hard, soft)
+	}
+
+	pod.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "gpu"}}
+	hard, _ = whyNodeTaint(pod, nil, node)
+	if len(hard) != 1 || hard[0].Taint.Effect != v1.TaintEffectNoExecute {
+		t.Fatalf("want only NoExecute taint left, got %+v", hard)
+	}
+
+	// key 为空的 Exists 容忍所有 taint
+	pod.Spec.Tolerations = []v1.Toleration{{Operator: v1.TolerationOpExists}}
+	hard, soft = whyNodeTaint(pod, nil, node)
+	if len(hard)+len(soft) != 0 {
+		t.Fatalf("wildcard toleration should tolerate everything, got %+v %+v", hard, soft)
+	}
+
+	pod.Spec.Tolerations = []v1.Toleration{{Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute}}
+	hard, _ = whyNodeTaint(pod, nil, node)
+	if len(hard) != 1 || hard[0].Taint.Key != "dedicated" {
+		t.Fatalf("want only NoSchedule taint left, got %+v", hard)
+	}
+}
+
+func TestWhyNodeHealth(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	node := testNode("n1", nil)
+	node.Spec.Unschedulable = true
+	node.Status.Conditions = []v1.NodeCondition{
+		{Type: v1.NodeReady, Status: v1.ConditionUnknown, Message: "Kubelet stopped posting node status."},
+		{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+	}
+	lease := coordinationv1.Lease{}
+	lease.Name = "n1"
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: now.Add(-time.Minute)}
+
+	pod := &v1.Pod{}
+	cluster := &Cluster{Nodes: []v1.Node{node}, Leases: []coordinationv1.Lease{lease}, Now: now}
+	d := WhyPending(pod, cluster)[0]
+	if d.Schedulable {
+		t.Fatal("cordoned node should not be schedulable")
+	}
+	var types []NodeHealthType
+	for _, h := range d.NodeHealth {
+		types = append(types, h.Type)
+	}
+	want := []NodeHealthType{NodeHealthCordoned, NodeHealthNotReady, NodeHealthStaleLease}
+	if !slices.Equal(types, want) {
+		t.Fatalf("want %v, got %v", want, types)
+	}
+
+	// 只有 condition 而 node lifecycle controller 还没有添加 taint 时，NotReady 仅供参考
+	for _, h := range d.NodeHealth {
+		if h.Type == NodeHealthNotReady && h.Blocking {
+			t.Fatalf("NotReady without taint should not block, got %+v", h)
+		}
+	}
+	tainted := node.DeepCopy()
+	tainted.Spec.Unschedulable = false
+	tainted.Spec.Taints = []v1.Taint{{Key: v1.TaintNodeUnreachable, Effect: v1.TaintEffectNoExecute}}
+	taintedCluster := &Cluster{Nodes: []v1.Node{*tainted}, Now: now}
+	if d := WhyPending(pod, taintedCluster)[0]; len(d.NodeHealth) != 1 || !d.NodeHealth[0].Blocking {
+		t.Fatalf("want NotReady blocking with unreachable taint, got %+v", d.NodeHealth)
+	}
+	untainted := node.DeepCopy()
+	untainted.Spec.Unschedulable = false
+	if d := WhyPending(pod, &Cluster{Nodes: []v1.Node{*untainted}, Now: now})[0]; !d.Schedulable {
+		t.Fatalf("want schedulable without taint, got %+v", d.NodeHealth)
+	}
+
+	// DaemonSet 等容忍 unschedulable 和 unreachable 的 pod 不受影响
+	pod.Spec.Tolerations = []v1.Toleration{
+		{Key: v1.TaintNodeUnschedulable, Operator: v1.TolerationOpExists},
+		{Key: v1.TaintNodeUnreachable, Operator: v1.TolerationOpExists},
+	}
+	if d := WhyPending(pod, cluster)[0]; !d.Schedulable {
+		t.Fatalf("want schedulable when tolerated, got %+v", d.NodeHealth)
+	}
+	if d := WhyPending(pod, taintedCluster)[0]; !d.Schedulable {
+		t.Fatalf("want schedulable when taint tolerated, got %+v", d.NodeHealth)
+	}
+}
+
+func TestWhyHostPort(t *testing.T) {
+	withPort := func(name, hostIP string, port int32, protocol v1.Protocol) v1.Pod {
+		p := v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{
+			Ports: []v1.ContainerPort{{ContainerPort: port, HostPort: port, HostIP: hostIP, Protocol: protocol}},
+		}}}}
+		p.Namespace, p.Name = "default", name
+		return p
+	}
+	cases := []struct {
+		name     string
+		existing v1.Pod
+		pod      v1.Pod
+		conflict bool
+	}{
+		{"same port", withPort("a", "", 80, ""), withPort("b", "", 80, v1.ProtocolTCP), true},
+		{"different protocol", withPort("a", "", 53, v1.ProtocolUDP), withPort("b", "", 53, v1.ProtocolTCP), false},
+		{"wildcard existing", withPort("a", "0.0.0.0", 80, ""), withPort("b", "10.0.0.1", 80, ""), true},
+		{"wildcard wanted", withPort("a", "10.0.0.1", 80, ""), withPort("b", "", 80, ""), true},
+		{"different ips", withPort("a", "10.0.0.1", 80, ""), withPort("b", "10.0.0.2", 80, ""), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := whyHostPort(&c.pod, []v1.Pod{c.existing})
+			if (len(got) > 0) != c.conflict {
+				t.Fatalf("want conflict %v, got %+v", c.conflict, got)
+			}
+		})
+	}
+
+	// hostNetwork 的 pod 未填 hostPort 时使用 containerPort
+	pod := v1.Pod{Spec: v1.PodSpec{HostNetwork: true, Containers: []v1.Container{{
+		Ports: []v1.ContainerPort{{ContainerPort: 80}},
+	}}}}
+	if got := whyHostPort(&pod, []v1.Pod{withPort("a", "", 80, "")}); len(got) != 1 || got[0].PodName != "a" {
+		t.Fatalf("want conflict with a, got %+v", got)
+	}
+
+	// 与上游一致，sidecar 的端口不参与检查
+	always := v1.ContainerRestartPolicyAlways
+	withSidecar := withPort("s", "", 80, "")
+	withSidecar.Spec.InitContainers = withSidecar.Spec.Containers
+	withSidecar.Spec.InitContainers[0].RestartPolicy = &always
+	withSidecar.Spec.Containers = nil
+	if got := whyHostPort(&withSidecar, []v1.Pod{withPort("a", "", 80, "")}); len(got) != 0 {
+		t.Fatalf("sidecar ports should be ignored, got %+v", got)
+	}
+}
+
+func TestMaxPods(t *testing.T) {
+	node := testNode("n1", nil)
+	node.Status.Allocatable[v1.ResourcePods] = resource.MustParse("1")
+	running := v1.Pod{Spec: v1.PodSpec{NodeName: "n1"}}
+	running.Namespace, running.Name = "default", "running"
+
+	pod := &v1.Pod{}
+	pod.Namespace, pod.Name = "default", "pending"
+	got := WhyPending(pod, &Cluster{Pods: []v1.Pod{running}, Nodes: []v1.Node{node}})[0].ResourceNotEnough
+	if len(got) != 1 || got[0].ResourceName != string(v1.ResourcePods) {
+		t.Fatalf("want pods not enough, got %+v", got)
+	}
+}
+
+func TestWhyVolumeLimit(t *testing.T) {
+	const driver = "ebs.csi.aws.com"
+	newPV := func(name string) v1.PersistentVolume {
+		pv := v1.PersistentVolume{}
+		pv.Name = name
+		pv.Spec.CSI = &v1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: "vol-" + name}
+		return pv
+	}
+	newPVC := func(name, pvName string) v1.PersistentVolumeClaim {
+		pvc := v1.PersistentVolumeClaim{}
+		pvc.Namespace, pvc.Name = "default", name
+		pvc.Spec.VolumeName = pvName
+		return pvc
+	}
+	withClaims := func(name, nodeName string, claims ...string) v1.Pod {
+		p := v1.Pod{Spec: v1.PodSpec{NodeName: nodeName}}
+		p.Namespace, p.Name = "default", name
+		for _, c := range claims {
+			p.Spec.Volumes = append(p.Spec.Volumes, v1.Volume{
+				Name:         c,
+				VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: c}},
+			})
+		}
+		return p
+	}
+	limit := int32(2)
+	csiNode := storagev1.CSINode{Spec: storagev1.CSINodeSpec{Drivers: []storagev1.CSINodeDriver{
+		{Name: driver, Allocatable: &storagev1.VolumeNodeResources{Count: &limit}},
+	}}}
+	csiNode.Name = "n1"
+
+	cluster := &Cluster{
+		Nodes: []v1.Node{testNode("n1", nil)},
+		// a 和 b 共用 pvc-a，只算一个 volume
+		Pods: []v1.Pod{withClaims("a", "n1", "pvc-a"), withClaims("b", "n1", "pvc-a", "pvc-b")},
+		PVCs: []v1.PersistentVolumeClaim{
+			newPVC("pvc-a", "pv-a"), newPVC("pvc-b", "pv-b"), newPVC("pvc-c", "pv-c"),
+		},
+		PVs:      []v1.PersistentVolume{newPV("pv-a"), newPV("pv-b"), newPV("pv-c")},
+		CSINodes: []storagev1.CSINode{csiNode},
+	}
+	pod := withClaims("pending", "", "pvc-a", "pvc-c")
+	got := WhyPending(&pod, cluster)[0].VolumeLimitExceeded
+	if len(got) != 1 || got[0].Attached != 2 || got[0].Required != 1 {
+		t.Fatalf("want 2 attached + 1 new > 2, got %+v", got)
+	}
+
+	pod = withClaims("pending", "", "pvc-a", "pvc-b")
+	if got := WhyPending(&pod, cluster)[0].VolumeLimitExceeded; len(got) != 0 {
+		t.Fatalf("already attached volumes need no new slot, got %+v", got)
+	}
+}
+
+func TestWhyStorage(t *testing.T) {
+	wffc := storagev1.VolumeBindingWaitForFirstConsumer
+	local := storagev1.StorageClass{Provisioner: noProvisioner, VolumeBindingMode: &wffc}
+	local.Name = "local"
+	zonal := storagev1.StorageClass{
+		Provisioner:       "ebs.csi.aws.com",
+		VolumeBindingMode: &wffc,
+		AllowedTopologies: []v1.TopologySelectorTerm{{MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+			{Key: "zone", Values: []string{"a"}},
+		}}},
+	}
+	zonal.Name = "zonal"
+
+	newPVC := func(name, class string) v1.PersistentVolumeClaim {
+		pvc := v1.PersistentVolumeClaim{}
+		pvc.Namespace, pvc.Name = "default", name
+		pvc.Spec.StorageClassName = &class
+		pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+		pvc.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")}
+		return pvc
+	}
+	localPV := v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{
+		StorageClassName: "local",
+		AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+		Capacity:         v1.ResourceList{v1.ResourceStorage: resource.MustParse("20Gi")},
+		NodeAffinity: &v1.VolumeNodeAffinity{Required: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+			MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"n2"}}},
+		}}}},
+	}}
+	localPV.Name = "local-n2"
+	localPV.Status.Phase = v1.VolumeAvailable
+
+	pod := &v1.Pod{}
+	pod.Namespace, pod.Name = "default", "db"
+	for _, c := range []string{"missing", "immediate", "data", "cache"} {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+			Name:         c,
+			VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: c}},
+		})
+	}
+	cluster := &Cluster{
+		Nodes:          []v1.Node{zoneNode("n1", "a"), zoneNode("n2", "b")},
+		PVCs:           []v1.PersistentVolumeClaim{newPVC("immediate", ""), newPVC("data", "local"), newPVC("cache", "zonal")},
+		PVs:            []v1.PersistentVolume{localPV},
+		StorageClasses: []storagev1.StorageClass{local, zonal},
+	}
+
+	claims := WhyStorage(pod, cluster)
+	var statuses []PvcStatus
+	for _, c := range claims {
+		statuses = append(statuses, c.Status)
+	}
+	want := []PvcStatus{PvcStatusMissing, PvcStatusPending, PvcStatusWaitForFirstConsumer, PvcStatusWaitForFirstConsumer}
+	if !slices.Equal(statuses, want) {
+		t.Fatalf("want %v, got %v", want, statuses)
+	}
+	if !slices.Equal(claims[2].AvailablePVs, []string{"local-n2"}) {
+		t.Fatalf("want local-n2 available, got %v", claims[2].AvailablePVs)
+	}
+
+	ans := WhyPending(pod, cluster)
+	// n1 上没有合适的本地 pv，n2 不在 zonal 的 allowedTopologies 中
+	if got := ans[0].VolumeBindingMismatch; len(got) != 1 || got[0].ClaimName != "data" {
+		t.Fatalf("want data unbindable on n1, got %+v", got)
+	}
+	if got := ans[1].VolumeBindingMismatch; len(got) != 1 || got[0].ClaimName != "cache" {
+		t.Fatalf("want cache unbindable on n2, got %+v", got)
+	}
+
+	// 缺失和未绑定的 Immediate pvc 使每个 node 都不可调度
+	pod.Spec.Volumes = pod.Spec.Volumes[:2]
+	for _, d := range WhyPending(pod, cluster) {
+		if d.Schedulable || countYpdNodes([]Detail{d}, ReasonVolumeBindingMismatch, "") != 1 {
+			t.Fatalf("want %s blocked by volume binding, got %s", d.NodeName, d.String())
+		}
+	}
+
+	// 绑定到不存在的 pv 时同样在每个 node 上无法调度
+	gone := newPVC("gone", "local")
+	gone.Spec.VolumeName = "pv-gone"
+	cluster.PVCs = append(cluster.PVCs, gone)
+	pod.Spec.Volumes = []v1.Volume{{
+		Name:         "gone",
+		VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "gone"}},
+	}}
+	if claims := WhyStorage(pod, cluster); len(claims) != 1 || claims[0].Status != PvcStatusPvMissing || !claims[0].Blocking {
+		t.Fatalf("want blocking PvMissing claim, got %+v", claims)
+	}
+	for _, d := range WhyPending(pod, cluster) {
+		if d.Schedulable || countYpdNodes([]Detail{d}, ReasonVolumeBindingMismatch, "") != 1 {
+			t.Fatalf("want %s blocked by missing pv, got %s", d.NodeName, d.String())
+		}
+	}
+}
+
+func TestWhyVolumeConflict(t *testing.T) {
+	withClaim := func(name, nodeName, claim string) v1.Pod {
+		p := v1.Pod{Spec: v1.PodSpec{NodeName: nodeName, Volumes: []v1.Volume{{
+			Name:         "data",
+			VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+		}}}}
+		p.Namespace, p.Name = "default", name
+		return p
+	}
+	newPVC := func(name, pvName string, mode v1.PersistentVolumeAccessMode) v1.PersistentVolumeClaim {
+		pvc := v1.PersistentVolumeClaim{}
+		pvc.Namespace, pvc.Name = "default", name
+		pvc.Spec.VolumeName = pvName
+		pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{mode}
+		return pvc
+	}
+	pv := v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}}}
+	pv.Name = "pv-rwo"
+	pvName := pv.Name
+	va := storagev1.VolumeAttachment{Spec: storagev1.VolumeAttachmentSpec{
+		NodeName: "n2",
+		Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+	}}
+	va.Name = "csi-123"
+	va.Status.Attached = true
+
+	cluster := &Cluster{
+		Nodes: []v1.Node{testNode("n1", nil), testNode("n2", nil)},
+		Pods:  []v1.Pod{withClaim("owner", "n1", "rwop")},
+		PVCs: []v1.PersistentVolumeClaim{
+			newPVC("rwop", "", v1.ReadWriteOncePod),
+			newPVC("rwo", "pv-rwo", v1.ReadWriteOnce),
+		},
+		PVs:               []v1.PersistentVolume{pv},
+		VolumeAttachments: []storagev1.VolumeAttachment{va},
+	}
+
+	pod := withClaim("web", "", "rwop")
+	for _, d := range WhyPending(&pod, cluster) {
+		if len(d.VolumeConflict) != 1 || d.VolumeConflict[0].PodName != "owner" {
+			t.Fatalf("want rwop pvc held by owner on %s, got %+v", d.NodeName, d.VolumeConflict)
+		}
+		if d.Schedulable {
+			t.Fatalf("rwop conflict should block %s", d.NodeName)
+		}
+	}
+
+	pod = withClaim("web", "", "rwo")
+	ans := WhyPending(&pod, cluster)
+	if got := ans[0].VolumeConflict; len(got) != 1 || got[0].NodeName != "n2" || got[0].AttachmentName != "csi-123" {
+		t.Fatalf("want rwo volume attached to n2, got %+v", got)
+	}
+	if !ans[0].Schedulable || ans[0].Findings[0].Severity != SeverityWarning {
+		t.Fatalf("rwo volume attached elsewhere should only warn, got %+v", ans[0].Findings)
+	}
+	if got := ans[1].VolumeConflict; len(got) != 0 {
+		t.Fatalf("n2 holds the volume, got %+v", got)
+	}
+}
+
+func TestWhyPreemption(t *testing.T) {
+	newNode := func(name string) v1.Node {
+		n := testNode(name, nil)
+		n.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("2")
+		return n
+	}
+	newPod := func(name, nodeName, cpu string, priority int32, labels map[string]string) v1.Pod {
+		p := v1.Pod{Spec: v1.PodSpec{NodeName: nodeName, Containers: []v1.Container{container(cpu)}, Priority: &priority}}
+		p.Namespace, p.Name, p.Labels = "default", name, labels
+		return p
+	}
+	pdb := policyv1.PodDisruptionBudget{Spec: policyv1.PodDisruptionBudgetSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}},
+	}}
+	pdb.Namespace, pdb.Name = "default", "pdb-a"
+	high := schedulingv1.PriorityClass{Value: 100}
+	high.Name = "high"
+
+	cluster := &Cluster{
+		Nodes: []v1.Node{newNode("n1"), newNode("n2"), newNode("n3")},
+		Pods: []v1.Pod{
+			newPod("a", "n1", "1", 0, map[string]string{"app": "a"}),
+			newPod("b", "n1", "1", 0, nil),
+			// 优先级更高，不能被驱逐
+			newPod("c", "n2", "2", 1000, nil),
+			newPod("d", "n3", "2", 50, nil),
+		},
+		PriorityClasses: []schedulingv1.PriorityClass{high},
+		PDBs:            []policyv1.PodDisruptionBudget{pdb},
+	}
+	pod := newPod("pending", "", "1", 0, nil)
+	pod.Spec.Priority = nil
+	pod.Spec.PriorityClassName = "high"
+
+	got := WhyPreemption(&pod, cluster)
+	if got.Priority != 100 || got.NominatedNodeName != "n1" || len(got.Candidates) != 2 {
+		t.Fatalf("want n1 nominated among n1 and n3, got %+v", got)
+	}
+	// 优先放回受 PDB 保护的 a，只驱逐 b
+	if v := got.Candidates[0].Victims; len(v) != 1 || v[0].PodName != "b" || got.Candidates[0].PDBViolations != 0 {
+		t.Fatalf("want only b evicted on n1, got %+v", got.Candidates[0])
+	}
+
+	// node 上没有的资源被忽略后，与 WhyPendingWithOptions 一样不再阻止调度
+	foo := pod.DeepCopy()
+	foo.Spec.Containers[0].Resources.Requests["example.com/foo"] = resource.MustParse("1")
+	if got := WhyPreemption(foo, cluster); len(got.Candidates) != 0 {
+		t.Fatalf("evicting pods cannot provide example.com/foo, got %+v", got.Candidates)
+	}
+	got, err := WhyPreemptionWithOptions(foo, cluster, Options{IgnoredResources: []string{"example.com/foo"}})
+	if err != nil || got.NominatedNodeName != "n1" || len(got.Candidates) != 2 {
+		t.Fatalf("want n1 nominated with example.com/foo ignored, got %+v, %v", got, err)
+	}
+	if _, err := WhyPreemptionWithOptions(foo, cluster, Options{Disabled: []string{"NoSuchChecker"}}); err == nil {
+		t.Fatal("want error for unknown checker")
+	}
+
+	// 有 node 可以直接调度时调度器不会抢占
+	fits := &Cluster{
+		Nodes:           []v1.Node{newNode("full"), newNode("free")},
+		Pods:            []v1.Pod{newPod("low", "full", "2", 0, nil)},
+		PriorityClasses: []schedulingv1.PriorityClass{high},
+	}
+	if got := WhyPreemption(&pod, fits); len(got.Candidates) != 0 || len(got.NominatedNodeName) > 0 {
+		t.Fatalf("want no preemption when free fits, got %+v", got)
+	}
+
+	never := v1.PreemptNever
+	pod.Spec.PreemptionPolicy = &never
+	if got := WhyPreemption(&pod, cluster); len(got.Candidates) != 0 {
+		t.Fatalf("want no preemption with policy Never, got %+v", got)
+	}
+}
+
+func TestWithNodePods(t *testing.T) {
+	zoneNode := func(name, zone string) v1.Node {
+		return testNode(name, map[string]string{"zone": zone, "kubernetes.io/hostname": name})
+	}
+	newPod := func(name, nodeName string) v1.Pod {
+		p := v1.Pod{Spec: v1.PodSpec{NodeName: nodeName, Volumes: []v1.Volume{{
+			Name:         "data",
+			VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "shared"}},
+		}}}}
+		p.Namespace, p.Name, p.Labels = "default", name, map[string]string{"app": "web"}
+		p.Spec.Affinity = &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+				TopologyKey:   "zone",
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			}},
+		}}
+		return p
+	}
+	cluster := &Cluster{
+		Nodes: []v1.Node{zoneNode("n1", "a"), zoneNode("n2", "a"), zoneNode("n3", "b")},
+		Pods:  []v1.Pod{newPod("p1", "n1"), newPod("p2", "n1"), newPod("p3", "n2"), newPod("p4", "n3")},
+	}
+	pod := newPod("web", "")
+	pod.Spec.TopologySpreadConstraints = []v1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       "zone",
+		WhenUnsatisfiable: v1.DoNotSchedule,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	}}
+
+	type index struct {
+		claimUsers   map[string][]string
+		counts       map[string]int
+		minMatch     int
+		antiAffinity map[topologyPair][]string
+	}
+	indexOf := func(s *snapshot) index {
+		ans := index{
+			claimUsers:   map[string][]string{},
+			counts:       s.spreadConstraints[0].counts,
+			minMatch:     s.spreadConstraints[0].minMatch,
+			antiAffinity: map[topologyPair][]string{},
+		}
+		for key, users := range s.claimUsers {
+			for _, u := range users {
+				ans.claimUsers[key] = append(ans.claimUsers[key], u.Name)
+			}
+			slices.Sort(ans.claimUsers[key])
+		}
+		for pair, ms := range s.existingAntiAffinity {
+			for _, m := range ms {
+				ans.antiAffinity[pair] = append(ans.antiAffinity[pair], m.PodName)
+			}
+			slices.Sort(ans.antiAffinity[pair])
+		}
+		return ans
+	}
+
+	snap := newSnapshot(&pod, cluster)
+	before := indexOf(snap)
+	// 移除 n1 上的 p1，增量结果应与重新计算一致
+	got := indexOf(snap.withNodePods(&pod, "n1", []v1.Pod{cluster.Pods[1]}))
+	full := *snap
+	full.node2pods = map[string][]v1.Pod{"n1": {cluster.Pods[1]}, "n2": {cluster.Pods[2]}, "n3": {cluster.Pods[3]}}
+	full.index(&pod)
+	if want := indexOf(&full); !reflect.DeepEqual(got, want) {
+		t.Fatalf("incremental index differs from full index:\n got %+v\nwant %+v", got, want)
+	}
+	if got.counts["a"] != 2 || len(got.claimUsers["default/shared"]) != 3 || len(got.antiAffinity[topologyPair{"zone", "a"}]) != 2 {
+		t.Fatalf("want p1 removed from every index, got %+v", got)
+	}
+	if after := indexOf(snap); !reflect.DeepEqual(before, after) {
+		t.Fatalf("withNodePods modified the original snapshot:\n got %+v\nwant %+v", after, before)
+	}
+}
+
+func TestWhyResourceClaim(t *testing.T) {
+	const driver = "gpu.example.com"
+	a100 := resourcev1beta1.DeviceAttribute{StringValue: ptr.To("a100")}
+	newSlice := func(nodeName string, devices ...string) resourcev1beta1.ResourceSlice {
+		s := resourcev1beta1.ResourceSlice{Spec: resourcev1beta1.ResourceSliceSpec{
+			Driver:   driver,
+			Pool:     resourcev1beta1.ResourcePool{Name: nodeName},
+			NodeName: nodeName,
+		}}
+		s.Name = nodeName + "-gpus"
+		for _, d := range devices {
+			s.Spec.Devices = append(s.Spec.Devices, resourcev1beta1.Device{
+				Name:  d,
+				Basic: &resourcev1beta1.BasicDevice{Attributes: map[resourcev1beta1.QualifiedName]resourcev1beta1.DeviceAttribute{"model": a100}},
+			})
+		}
+		return s
+	}
+	class := resourcev1beta1.DeviceClass{Spec: resourcev1beta1.DeviceClassSpec{Selectors: []resourcev1beta1.DeviceSelector{
+		{CEL: &resourcev1beta1.CELDeviceSelector{Expression: `device.driver == "gpu.example.com"`}},
+	}}}
+	class.Name = "gpu"
+	// n1 上的 gpu-0 已被其他 claim 占用
+	allocated := resourcev1beta1.ResourceClaim{Status: resourcev1beta1.ResourceClaimStatus{
+		Allocation: &resourcev1beta1.AllocationResult{Devices: resourcev1beta1.DeviceAllocationResult{
+			Results: []resourcev1beta1.DeviceRequestAllocationResult{{Request: "gpu", Driver: driver, Pool: "n1", Device: "gpu-0"}},
+		}},
+	}}
+	allocated.Namespace, allocated.Name = "default", "other"
+	template := resourcev1beta1.ResourceClaimTemplate{Spec: resourcev1beta1.ResourceClaimTemplateSpec{
+		Spec: resourcev1beta1.ResourceClaimSpec{Devices: resourcev1beta1.DeviceClaim{Requests: []resourcev1beta1.DeviceRequest{{
+			Name:            "gpu",
+			DeviceClassName: "gpu",
+			Count:           2,
+			Selectors: []resourcev1beta1.DeviceSelector{
+				{CEL: &resourcev1beta1.CELDeviceSelector{Expression: `device.attributes["gpu.example.com"].model == "a100"`}},
+			},
+		}}}},
+	}}
+	template.Namespace, template.Name = "default", "two-gpus"
+
+	cluster := &Cluster{
+		Nodes:                  []v1.Node{testNode("n1", nil), testNode("n2", nil), testNode("n3", nil)},
+		ResourceClaims:         []resourcev1beta1.ResourceClaim{allocated},
+		ResourceClaimTemplates: []resourcev1beta1.ResourceClaimTemplate{template},
+		DeviceClasses:          []resourcev1beta1.DeviceClass{class},
+		ResourceSlices:         []resourcev1beta1.ResourceSlice{newSlice("n1", "gpu-0", "gpu-1"), newSlice("n2", "gpu-0", "gpu-1")},
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{ResourceClaims: []v1.PodResourceClaim{{Name: "gpus", ResourceClaimTemplateName: ptr.To("two-gpus")}}}}
+	pod.Namespace, pod.Name = "default", "pending"
+
+	ans := WhyPending(pod, cluster)
+	if got := ans[0].ResourceClaimNotSatisfied; len(got) != 1 || got[0].Request != "gpu" || got[0].Matched != 2 || got[0].Available != 1 {
+		t.Fatalf("want 1 of 2 gpus available on n1, got %+v", got)
+	}
+	if !ans[1].Schedulable {
+		t.Fatalf("want n2 schedulable, got %s", ans[1].String())
+	}
+	if got := ans[2].ResourceClaimNotSatisfied; len(got) != 1 || got[0].Matched != 0 {
+		t.Fatalf("want no gpu on n3, got %+v", got)
+	}
+}
+
+func TestWhyPod(t *testing.T) {
+	now := time.Now()
+	lease := coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{
+		RenewTime:            &metav1.MicroTime{Time: now.Add(-5 * time.Second)},
+		LeaseDurationSeconds: ptr.To[int32](15),
+	}}
+	lease.Namespace, lease.Name = metav1.NamespaceSystem, "kube-scheduler"
+	cluster := &Cluster{
+		Nodes:           []v1.Node{testNode("n1", nil)},
+		SchedulerLeases: []coordinationv1.Lease{lease},
+		Now:             now,
+	}
+	newPod := func(spec v1.PodSpec) *v1.Pod {
+		p := &v1.Pod{Spec: spec}
+		p.Namespace, p.Name = "default", "pending"
+		return p
+	}
+	reasons := func(d PodDetail) []Reason {
+		var ans []Reason
+		for _, b := range d.Blockers {
+			ans = append(ans, b.Reason)
+		}
+		return ans
+	}
+
+	tests := []struct {
+		name string
+		spec v1.PodSpec
+		want []Reason
+	}{
+		{name: "default scheduler running", spec: v1.PodSpec{}},
+		{
+			name: "gated",
+			spec: v1.PodSpec{SchedulingGates: []v1.PodSchedulingGate{{Name: "example.com/quota"}}},
+			want: []Reason{ReasonSchedulingGated},
+		},
+		{name: "custom scheduler without lease", spec: v1.PodSpec{SchedulerName: "my-scheduler"}},
+		{name: "bound to missing node", spec: v1.PodSpec{NodeName: "gone"}, want: []Reason{ReasonNodeNotFound}},
+		{name: "bound to existing node", spec: v1.PodSpec{NodeName: "n1", SchedulerName: "my-scheduler"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reasons(WhyPod(newPod(tt.spec), cluster)); !slices.Equal(got, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// 没有 lease 也没有 event 时无法确定调度器是否在运行
+	if got := WhyPod(newPod(v1.PodSpec{SchedulerName: "my-scheduler"}), cluster); len(got.Warnings) != 1 || got.Warnings[0].Reason != ReasonSchedulerNotRunning {
+		t.Fatalf("want scheduler warning, got %+v", got.Warnings)
+	}
+	// lease 存在但已过期
+	stale := lease
+	stale.Name = "my-scheduler"
+	stale.Spec.RenewTime = &metav1.MicroTime{Time: now.Add(-time.Minute)}
+	staleCluster := *cluster
+	staleCluster.SchedulerLeases = []coordinationv1.Lease{lease, stale}
+	if got := reasons(WhyPod(newPod(v1.PodSpec{SchedulerName: "my-scheduler"}), &staleCluster)); !slices.Equal(got, []Reason{ReasonSchedulerNotRunning}) {
+		t.Fatalf("want scheduler not running, got %v", got)
+	}
+
+	// 调度器为 pod 产生过 event 说明它在运行
+	event := v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pending"},
+		Source:         v1.EventSource{Component: "my-scheduler"},
+	}
+	cluster.Events = []v1.Event{event}
+	if got := WhyPod(newPod(v1.PodSpec{SchedulerName: "my-scheduler"}), cluster); len(got.Blockers) != 0 {
+		t.Fatalf("want no blockers, got %+v", got.Blockers)
+	}
+}
+
+func TestRuntimeClass(t *testing.T) {
+	gpuNode := testNode("n1", map[string]string{"gpu": "true"})
+	gpuNode.Spec.Taints = []v1.Taint{{Key: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	rc := nodev1.RuntimeClass{Handler: "nvidia", Scheduling: &nodev1.Scheduling{
+		NodeSelector: map[string]string{"gpu": "true"},
+		Tolerations:  []v1.Toleration{{Key: "gpu", Operator: v1.TolerationOpExists}},
+	}}
+	rc.Name = "nvidia"
+	cluster := &Cluster{
+		Nodes:          []v1.Node{gpuNode, testNode("n2", nil)},
+		RuntimeClasses: []nodev1.RuntimeClass{rc},
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{RuntimeClassName: ptr.To("nvidia")}}
+	pod.Namespace, pod.Name = "default", "pending"
+
+	ans := WhyPending(pod, cluster)
+	if !ans[0].Schedulable {
+		t.Fatalf("want runtime class tolerations applied on n1, got %s", ans[0].String())
+	}
+	if got := ans[1].NodeAffinityMismatch; len(got) != 1 || got[0].RuntimeClass != "nvidia" {
+		t.Fatalf("want runtime class nodeSelector mismatch on n2, got %+v", got)
+	}
+
+	pod.Spec.RuntimeClassName = ptr.To("missing")
+	if got := WhyPod(pod, cluster).Blockers; len(got) == 0 || got[0].Reason != ReasonRuntimeClassNotFound {
+		t.Fatalf("want runtime class not found, got %+v", got)
+	}
+}
+
+func TestCheckerRegistry(t *testing.T) {
+	// 只对带有 label example.com/drain 的 node 生效，不影响其他测试
+	Register(CheckerFunc("ExampleDrain", func(in *CheckInput) []Finding {
+		if _, ok := in.Node.Labels["example.com/drain"]; !ok {
+			return nil
+		}
+		return []Finding{{Reason: "NodeDraining", Severity: SeverityBlocking, Message: "node is being drained"}}
+	}))
+	if !slices.Contains(CheckerNames(), "ExampleDrain") || IsBuiltinChecker("ExampleDrain") {
+		t.Fatalf("want ExampleDrain registered as third-party checker, got %v", CheckerNames())
+	}
+
+	node := testNode("n1", map[string]string{"example.com/drain": ""})
+	node.Spec.Taints = []v1.Taint{{Key: "dedicated", Effect: v1.TaintEffectNoSchedule}}
+	cluster := &Cluster{Nodes: []v1.Node{node}}
+	pod := &v1.Pod{}
+	pod.Namespace, pod.Name = "default", "pending"
+
+	ans := WhyPending(pod, cluster)
+	if got := ans[0].String(); got != "n1 NodeTaintNotTolerated NodeDraining" {
+		t.Fatalf("want taint and drain findings, got %s", got)
+	}
+	if f := ans[0].Findings[len(ans[0].Findings)-1]; f.Checker != "ExampleDrain" {
+		t.Fatalf("want checker name filled, got %+v", f)
+	}
+	// json 中每个结果只在 findings 中出现一次
+	data, err := json.Marshal(ans[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte(`"dedicated"`)) != 1 || bytes.Contains(data, []byte(`"nodeTaintNotTolerated"`)) {
+		t.Fatalf("want taint only in findings, got %s", data)
+	}
+
+	ans, err = WhyPendingWithOptions(pod, cluster, Options{Disabled: []string{"ExampleDrain", CheckerTaintToleration}})
+	if err != nil || !ans[0].Schedulable || len(ans[0].NodeTaintNotTolerated) != 0 {
+		t.Fatalf("want schedulable with checkers disabled, got %+v %v", ans, err)
+	}
+	ans, err = WhyPendingWithOptions(pod, cluster, Options{Enabled: []string{"ExampleDrain"}})
+	if err != nil || ans[0].String() != "n1 NodeDraining" {
+		t.Fatalf("want only ExampleDrain, got %+v %v", ans, err)
+	}
+	if _, err := WhyPendingWithOptions(pod, cluster, Options{Disabled: []string{"NoSuchChecker"}}); err == nil {
+		t.Fatalf("want error for unknown checker")
+	}
+}
+
+func TestIgnoresResource(t *testing.T) {
+	opts := &Options{IgnoredResources: []string{"example.com/foo", "cpu"}, IgnoredResourceGroups: []string{"vendor.io"}}
+	cases := map[v1.ResourceName]bool{
+		"example.com/foo":         true,
+		"example.com/bar":         false,
+		"vendor.io/gpu":           true,
+		v1.ResourceCPU:            false,
+		"hugepages-2Mi":           false,
+		"kubernetes.io/batch-cpu": false,
+		"requests.vendor.io/gpu":  false,
+	}
+	for name, want := range cases {
+		if got := opts.ignoresResource(name); got != want {
+			t.Errorf("%s: want %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestWhySchedulingEvent(t *testing.T) {
+	nodes, reasons, ok := parseFailedScheduling("0/4 nodes are available: pod has unbound immediate PersistentVolumeClaims. preemption: 0/4 nodes are available: 4 Preemption is not helpful for scheduling.")
+	if !ok || nodes != 4 || len(reasons) != 1 || reasons[0].EventNodes != 4 || reasons[0].Reason != ReasonVolumeBindingMismatch {
+		t.Fatalf("unexpected prefilter parse %d %+v", nodes, reasons)
+	}
+
+	tainted := testNode("tainted", nil)
+	tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	small := testNode("small", nil)
+	small.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("500m")
+	fit := testNode("fit", nil)
+	fit.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("4")
+	tainted.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("4")
+
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{container("1")}}}
+	pod.Namespace, pod.Name = "default", "pending"
+	event := v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pending"},
+		Reason:         "FailedScheduling",
+		Message: "0/3 nodes are available: 1 Insufficient cpu, 1 node(s) didn't have free ports for the requested pod ports, " +
+			"1 node(s) had untolerated taint {dedicated: gpu}. preemption: 0/3 nodes are available: 3 Preemption is not helpful for scheduling.",
+	}
+	cluster := &Cluster{Nodes: []v1.Node{tainted, small, fit}, Events: []v1.Event{event}}
+	d := WhySchedulingEvent(pod, cluster, WhyPending(pod, cluster))
+	if d == nil || d.Nodes != 3 || d.YpdSchedulableNodes != 1 {
+		t.Fatalf("unexpected event detail %+v", d)
+	}
+	want := []DetailEventReason{
+		{Message: "Insufficient cpu", Reason: ReasonResourceNotEnough, Key: "cpu", EventNodes: 1, YpdNodes: 1},
+		{Message: "node(s) didn't have free ports for the requested pod ports", Reason: ReasonHostPortConflict, EventNodes: 1, Disagree: true},
+		{Message: "node(s) had untolerated taint {dedicated: gpu}", Reason: ReasonNodeTaintNotTolerated, Key: "dedicated", EventNodes: 1, YpdNodes: 1},
+	}
+	if !reflect.DeepEqual(d.Reasons, want) {
+		t.Fatalf("want %+v, got %+v", want, d.Reasons)
+	}
+	// 端口冲突和可调度的 node 各一条
+	if len(d.Disagreements) != 2 {
+		t.Fatalf("want 2 disagreements, got %v", d.Disagreements)
+	}
+}